@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"final_project/handlers"
+	"final_project/repository"
+)
+
+// cliContext attributes the writes of commands to "cli" in the audit log.
+func cliContext() context.Context {
+	return repository.WithActor(context.Background(), "cli")
+}
+
+func migrate(args []string) error {
+	var dbFile string
+	flags := newFlagSet("migrate", &dbFile)
+	flags.Parse(args)
+	before := 0
+	if _, err := os.Stat(dbFile); err == nil {
+		if before, err = repository.CheckDatabase(context.Background(), dbFile); err != nil {
+			return err
+		}
+	}
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	fmt.Printf("Schema version %d, %d migrations applied\n", repository.SchemaVersion(), repository.SchemaVersion()-before)
+	return nil
+}
+
+func backup(args []string) error {
+	var dbFile, dir string
+	flags := newFlagSet("backup", &dbFile)
+	flags.StringVar(&dir, "dir", envOr("TODO_BACKUP_DIR", defaultBackupDir), "backup directory (TODO_BACKUP_DIR)")
+	flags.Parse(args)
+	keep, err := backupKeep()
+	if err != nil {
+		return err
+	}
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	path, err := repo.Backup(context.Background(), dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database backed up to %s\n", path)
+	_, err = repository.PruneBackups(dir, keep)
+	return err
+}
+
+// restore replaces the database with a backup after backing up the current database.
+func restore(args []string) error {
+	var dbFile, dir string
+	flags := newFlagSet("restore", &dbFile)
+	flags.StringVar(&dir, "dir", envOr("TODO_BACKUP_DIR", defaultBackupDir), "where the current database is backed up (TODO_BACKUP_DIR)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("restore needs the backup file")
+	}
+	file := flags.Arg(0)
+	if _, err := repository.CheckDatabase(context.Background(), file); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbFile); err == nil {
+		repo, err := repository.NewRepository(dbFile)
+		if err != nil {
+			return err
+		}
+		path, err := repo.Backup(context.Background(), dir)
+		repo.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("The current database is backed up to %s\n", path)
+	}
+	if err := repository.Restore(context.Background(), dbFile, file); err != nil {
+		return err
+	}
+	fmt.Printf("Database restored from %s\n", file)
+	return nil
+}
+
+// importTasks imports a file with handlers.ImportTasks and prints the rows that were not
+// imported. It fails if any row failed.
+func importTasks(args []string) error {
+	var dbFile, format string
+	var dryRun bool
+	flags := newFlagSet("import", &dbFile)
+	flags.StringVar(&format, "format", "", "json or csv, by default from the file extension")
+	flags.BoolVar(&dryRun, "dry-run", false, "only validate the file")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("import needs the file to import, - for stdin")
+	}
+	file := flags.Arg(0)
+	if format == "" {
+		format = formatOf(file)
+	}
+
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	result, err := handlers.ImportTasks(cliContext(), repo, data, format, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range result.Items {
+		switch {
+		case item.Error != "":
+			fmt.Printf("row %d %q: %s: %s\n", item.Index+1, item.Title, item.Status, item.Error)
+		case item.Warning != "":
+			fmt.Printf("row %d %q: %s: %s\n", item.Index+1, item.Title, item.Status, item.Warning)
+		}
+	}
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d tasks, skipped %d, failed %d\n", verb, result.Imported, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		return fmt.Errorf("%d rows failed", result.Failed)
+	}
+	return nil
+}
+
+func exportTasks(args []string) error {
+	var dbFile, format, output string
+	flags := newFlagSet("export", &dbFile)
+	flags.StringVar(&format, "format", "", "json or csv, by default from the output file extension or json")
+	flags.StringVar(&output, "o", "-", "output file, - for stdout")
+	flags.Parse(args)
+	if format == "" {
+		format = formatOf(output)
+	}
+
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	if output == "-" {
+		return handlers.ExportTasks(os.Stdout, repo, format)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err = handlers.ExportTasks(f, repo, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// formatOf tells the format of a file by its extension: csv or else json.
+func formatOf(file string) string {
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+// resetPassword stores a hash of the first line of stdin as the sign-in password, which
+// then takes the place of TODO_PASSWORD; -clear removes it. Both also replace the session
+// secret, signing everyone out. A running server picks the change up when restarted.
+func resetPassword(args []string) error {
+	var dbFile string
+	var clear bool
+	flags := newFlagSet("reset-password", &dbFile)
+	flags.BoolVar(&clear, "clear", false, "remove the stored password and use TODO_PASSWORD again")
+	flags.Parse(args)
+
+	password := ""
+	if !clear {
+		fmt.Fprint(os.Stderr, "New password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if password = strings.TrimRight(line, "\r\n"); password == "" {
+			return errors.New("the password is empty; use -clear to remove the stored password")
+		}
+	}
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	if err = repo.SetPassword(password); err != nil {
+		return err
+	}
+	if clear {
+		fmt.Println("The stored password is removed; restart the server to apply")
+	} else {
+		fmt.Println("The password is changed; restart the server to apply")
+	}
+	return nil
+}
+
+// check reports whether the server can start with the current settings and database,
+// without changing anything.
+func check(args []string) error {
+	var dbFile, port, webDir string
+	flags := newFlagSet("check", &dbFile)
+	serverFlags(flags, &port, &webDir)
+	flags.Parse(args)
+
+	failed := false
+	report := func(what string, err error, ok string) {
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL %s: %s\n", what, err)
+		} else {
+			fmt.Printf("ok   %s: %s\n", what, ok)
+		}
+	}
+
+	report("port", checkPort(port), port)
+	_, err := os.Stat(filepath.Join(webDir, "index.html"))
+	report("web", err, webDir)
+	s, err := loadSettings()
+	report("settings", err, "environment variables are valid")
+
+	if _, err = os.Stat(dbFile); errors.Is(err, os.ErrNotExist) {
+		report("database", nil, dbFile+" does not exist yet and is created on start")
+		return checkResult(failed)
+	}
+	version, err := repository.CheckDatabase(context.Background(), dbFile)
+	status := fmt.Sprintf("%s, schema version %d", dbFile, version)
+	if pending := repository.SchemaVersion() - version; err == nil && pending > 0 {
+		status += fmt.Sprintf(", %d migrations pending", pending)
+	}
+	report("database", err, status)
+	if err == nil && s != nil {
+		checkPassword(dbFile, s, version, report)
+	}
+	return checkResult(failed)
+}
+
+// checkPassword tells where the sign-in password comes from. Opening the repository
+// would migrate the database, so the settings table is only read once it exists.
+func checkPassword(dbFile string, s *settings, version int, report func(string, error, string)) {
+	hash := ""
+	if version == repository.SchemaVersion() {
+		repo, err := repository.NewRepository(dbFile)
+		if err != nil {
+			report("password", err, "")
+			return
+		}
+		hash, err = repo.PasswordHash()
+		repo.Close()
+		if err != nil {
+			report("password", err, "")
+			return
+		}
+	}
+	switch {
+	case hash != "":
+		report("password", nil, "set with reset-password")
+	case s.password != "":
+		report("password", nil, "TODO_PASSWORD")
+	default:
+		report("password", nil, "none, the API is open to everyone")
+	}
+}
+
+func checkResult(failed bool) error {
+	if failed {
+		return errors.New("the check failed")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRangeDays limits the ranges that recurring tasks are expanded over.
+const maxRangeDays = 366
+
+// HandleLoadGET sums up the estimates of the open tasks per day. Query parameters: from and
+// to (inclusive dates, a week from today by default) and capacity in minutes, which
+// overrides the configured daily capacity; days above it are flagged as overloaded.
+func (h *Handler) HandleLoadGET(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	capacity := h.DailyCapacity
+	if value := r.URL.Query().Get("capacity"); value != "" {
+		capacity, err = strconv.Atoi(value)
+		if err != nil || capacity < 0 {
+			writeError(w, errInvalid("capacity", "The capacity must be a non-negative number of minutes"))
+			return
+		}
+	}
+
+	days, err := h.Repo.GetLoad(from, to, capacity)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":     from.Format(timeLayout),
+		"to":       to.Format(timeLayout),
+		"capacity": capacity,
+		"days":     days,
+	})
+	if err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// parseDateRange reads the inclusive from and to dates. from defaults to today and to to
+// six days after from; the range may span at most maxRangeDays.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	params := r.URL.Query()
+	from, err := time.Parse(timeLayout, time.Now().Format(timeLayout))
+	if err != nil {
+		return from, from, err
+	}
+	if value := params.Get("from"); value != "" {
+		if from, err = time.Parse(timeLayout, value); err != nil {
+			return from, from, errInvalid("from", "Invalid date format: "+err.Error())
+		}
+	}
+	to := from.AddDate(0, 0, 6)
+	if value := params.Get("to"); value != "" {
+		if to, err = time.Parse(timeLayout, value); err != nil {
+			return from, to, errInvalid("to", "Invalid date format: "+err.Error())
+		}
+	}
+	if to.Before(from) {
+		return from, to, errInvalid("to", "The end of the range is before its start")
+	}
+	if to.Sub(from) >= maxRangeDays*24*time.Hour {
+		return from, to, errInvalid("to", fmt.Sprintf("The range may span at most %d days", maxRangeDays))
+	}
+	return from, to, nil
+}
+
+// HandleCalendarGET lists the days from from to to (inclusive dates, a week from today by
+// default) with the tasks occurring on each, for week and month views. Recurring tasks
+// appear on every repetition; entries beyond their stored date are marked virtual.
+func (h *Handler) HandleCalendarGET(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	days, err := h.Repo.GetCalendar(from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"from": from.Format(timeLayout),
+		"to":   to.Format(timeLayout),
+		"days": days,
+	})
+	if err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
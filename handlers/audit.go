@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"final_project/repository"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID tags every request with an ID, taken from the X-Request-ID header when the
+// client sends one, and echoes it back so that audit entries can be matched to requests.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(repository.WithRequestID(r.Context(), id)))
+	})
+}
+
+// HandleAuditGET lists task changes, newest first. Query parameters: task_id, actor,
+// from and to (YYYYMMDD or RFC 3339, inclusive) and limit.
+func (h *Handler) HandleAuditGET(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := repository.AuditQuery{
+		Actor: params.Get("actor"),
+		Limit: maxTasksPerPage,
+	}
+	var err error
+	if idStr := params.Get("task_id"); idStr != "" {
+		query.TaskID, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			writeError(w, errInvalid("task_id", "Invalid format of the task ID"))
+			return
+		}
+	}
+	if value := params.Get("from"); value != "" {
+		if query.From, err = parseAuditTime(value, false); err != nil {
+			writeError(w, errInvalid("from", err.Error()))
+			return
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if query.To, err = parseAuditTime(value, true); err != nil {
+			writeError(w, errInvalid("to", err.Error()))
+			return
+		}
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		query.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || query.Limit < 1 || query.Limit > maxTasksLimit {
+			writeError(w, errInvalid("limit", fmt.Sprintf("The limit must be a number from 1 to %d", maxTasksLimit)))
+			return
+		}
+	}
+
+	entries, err := h.Repo.GetAuditLog(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// parseAuditTime accepts a day or an exact time. A day used as the upper bound covers the whole day.
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if day, err := time.Parse(timeLayout, value); err == nil {
+		if endOfDay {
+			return day.Add(24*time.Hour - time.Second), nil
+		}
+		return day, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("Invalid time format, expected YYYYMMDD or RFC 3339")
+	}
+	return t, nil
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"final_project/repository"
+)
+
+type contextKey string
+
+const apiTokenKey contextKey = "apiToken"
+
+type tokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Auth accepts either a personal API token in the Authorization header or the
+// web UI session cookie. Without TODO_PASSWORD the session check is skipped,
+// but a presented API token is still verified and its scopes enforced.
+func (h *Handler) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authz := r.Header.Get("Authorization")
+		if strings.HasPrefix(authz, "Bearer ") {
+			token, err := h.Repo.LookupAPIToken(strings.TrimPrefix(authz, "Bearer "))
+			if err != nil {
+				writeError(w, errUnauthorized("Invalid API token"))
+				return
+			}
+			scope := repository.ScopeWrite
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+				scope = repository.ScopeRead
+			}
+			if !token.HasScope(scope) {
+				writeError(w, errForbidden("The API token lacks the '"+scope+"' scope"))
+				return
+			}
+			ctx := context.WithValue(r.Context(), apiTokenKey, token)
+			// Token names need not be unique, so the actor carries the ID as well.
+			ctx = repository.WithActor(ctx, "token:"+token.ID+":"+token.Name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		actor := "anonymous"
+		if h.hasPassword() {
+			if !h.validSession(r) {
+				writeError(w, errUnauthorized("Authentication required"))
+				return
+			}
+			actor = "user"
+		}
+		next.ServeHTTP(w, r.WithContext(repository.WithActor(r.Context(), actor)))
+	})
+}
+
+// requireSession keeps API tokens from administering the installation: managing other
+// tokens and backups. Without a password anyone who reaches the port would be signed in,
+// so then only requests from the machine itself are let through.
+func (h *Handler) requireSession(w http.ResponseWriter, r *http.Request) bool {
+	if r.Context().Value(apiTokenKey) != nil {
+		writeError(w, errForbidden("This endpoint cannot be used with an API token"))
+		return false
+	}
+	if !h.hasPassword() && !fromLoopback(r) {
+		writeError(w, errForbidden("Without a password this endpoint is only available from localhost"))
+		return false
+	}
+	return true
+}
+
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (h *Handler) HandleTokensGET(w http.ResponseWriter, r *http.Request) {
+	if !h.requireSession(w, r) {
+		return
+	}
+	tokens, err := h.Repo.ListAPITokens()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+func (h *Handler) HandleTokenPOST(w http.ResponseWriter, r *http.Request) {
+	if !h.requireSession(w, r) {
+		return
+	}
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	if req.Name == "" {
+		writeError(w, errInvalid("name", "The token name is not specified"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{repository.ScopeRead}
+	}
+	for _, scope := range req.Scopes {
+		if scope != repository.ScopeRead && scope != repository.ScopeWrite {
+			writeError(w, errInvalid("scopes", "Unknown scope: "+scope))
+			return
+		}
+	}
+
+	token, secret, err := h.Repo.CreateAPIToken(req.Name, req.Scopes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     token.ID,
+		"name":   token.Name,
+		"scopes": token.Scopes,
+		"token":  secret,
+	}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+func (h *Handler) HandleTokenDelete(w http.ResponseWriter, r *http.Request) {
+	if !h.requireSession(w, r) {
+		return
+	}
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		writeError(w, errInvalid("id", "The token ID is not specified"))
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeError(w, errInvalid("id", "Invalid format of the token ID"))
+		return
+	}
+	if err = h.Repo.RevokeAPIToken(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	sendSuccessResp(w)
+}
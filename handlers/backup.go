@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"final_project/repository"
+)
+
+type backupFile struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+// HandleBackupPOST snapshots the database into the backup directory and deletes the
+// backups beyond BackupKeep.
+func (h *Handler) HandleBackupPOST(w http.ResponseWriter, r *http.Request) {
+	if !h.requireSession(w, r) {
+		return
+	}
+	path, err := h.Repo.Backup(r.Context(), h.BackupDir)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	removed, err := repository.PruneBackups(h.BackupDir, h.BackupKeep)
+	if err != nil {
+		log.Printf("Error deleting old backups: %s", err)
+	}
+	names := []string{}
+	for _, path := range removed {
+		names = append(names, filepath.Base(path))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":    filepath.Base(path),
+		"size":    info.Size(),
+		"removed": names,
+	})
+	if err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// HandleBackupsGET lists the backups, newest first.
+func (h *Handler) HandleBackupsGET(w http.ResponseWriter, r *http.Request) {
+	if !h.requireSession(w, r) {
+		return
+	}
+	paths, err := repository.ListBackups(h.BackupDir)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	backups := []backupFile{}
+	for i := len(paths) - 1; i >= 0; i-- {
+		if info, err := os.Stat(paths[i]); err == nil {
+			backups = append(backups, backupFile{File: filepath.Base(paths[i]), Size: info.Size()})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(map[string]interface{}{"backups": backups}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
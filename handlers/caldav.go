@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"final_project/repository"
+)
+
+// CalDAV (RFC 4791) exposes the tasks as a single calendar of VTODO resources:
+// /caldav/ is both the principal and the calendar home, /caldav/tasks/ the calendar.
+const (
+	davHome     = "/caldav/"
+	davCalendar = "/caldav/tasks/"
+
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// DAVMethods are the methods beyond plain HTTP that the CalDAV routes use.
+var DAVMethods = []string{"PROPFIND", "REPORT"}
+
+// davChallenge asks CalDAV clients for Basic credentials when Auth rejects a request.
+type davChallenge struct {
+	http.ResponseWriter
+}
+
+func (w davChallenge) WriteHeader(status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="final_project"`)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// DAVAuth accepts HTTP Basic credentials, which is what CalDAV clients send: the password
+// is either the sign-in password or an API token, the user name is ignored. The request is then
+// checked by Auth.
+func (h *Handler) DAVAuth(next http.Handler) http.Handler {
+	auth := h.Auth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); ok {
+			r = r.Clone(r.Context())
+			r.Header.Del("Authorization")
+			switch {
+			case !strings.HasPrefix(password, repository.TokenPrefix) && h.checkPassword(password):
+				r.AddCookie(&http.Cookie{Name: "token", Value: h.session()})
+			case h.hasPassword() || strings.HasPrefix(password, repository.TokenPrefix):
+				r.Header.Set("Authorization", "Bearer "+password)
+			}
+		}
+		auth.ServeHTTP(davChallenge{w}, r)
+	})
+}
+
+// HandleDAVOptions advertises CalDAV support.
+func HandleDAVOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDAVPropfind answers PROPFIND on the home, the calendar or a task. Depth 1 on
+// a collection adds its members.
+func (h *Handler) HandleDAVPropfind(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prop *davPropNames `xml:"DAV: prop"`
+	}
+	if err := decodeDAVBody(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	depth := r.Header.Get("Depth") != "0"
+
+	var responses []davResponse
+	switch name := chi.URLParam(r, "name"); {
+	case name != "":
+		object, err := h.Repo.CalDAVObject(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		responses = append(responses, h.taskResponse(object, req.Prop))
+	case strings.HasPrefix(r.URL.Path, davCalendar):
+		response, err := h.calendarResponse(r, req.Prop)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		responses = append(responses, response)
+		if depth {
+			objects, err := h.Repo.CalDAVObjects()
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			for i := range objects {
+				responses = append(responses, h.taskResponse(&objects[i], req.Prop))
+			}
+		}
+	default:
+		responses = append(responses, homeResponse(req.Prop))
+		if depth {
+			response, err := h.calendarResponse(r, req.Prop)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			responses = append(responses, response)
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+// HandleDAVReport answers the calendar-query and calendar-multiget reports on the calendar.
+// Query filters other than the component type are not applied: all to-dos are returned.
+func (h *Handler) HandleDAVReport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		XMLName xml.Name
+		Prop    *davPropNames `xml:"DAV: prop"`
+		Hrefs   []string      `xml:"DAV: href"`
+		Filter  davFilter     `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	}
+	if err := decodeDAVBody(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var responses []davResponse
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		if !req.Filter.matchesTodo() {
+			break
+		}
+		objects, err := h.Repo.CalDAVObjects()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for i := range objects {
+			responses = append(responses, h.taskResponse(&objects[i], req.Prop))
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			object, err := h.Repo.CalDAVObject(path.Base(href))
+			if errors.Is(err, repository.ErrNotFound) || !strings.HasPrefix(href, davCalendar) {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			responses = append(responses, h.taskResponse(object, req.Prop))
+		}
+	default:
+		writeError(w, errForbidden("Unsupported report: "+req.XMLName.Local))
+		return
+	}
+	writeMultistatus(w, responses)
+}
+
+// HandleDAVGet returns a task as an iCalendar object with a single VTODO.
+func (h *Handler) HandleDAVGet(w http.ResponseWriter, r *http.Request) {
+	object, err := h.Repo.CalDAVObject(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", etag(object.Task.Version))
+	if _, err = w.Write(calendarData(object)); err != nil {
+		log.Printf("Error writing iCalendar response: %s", err.Error())
+	}
+}
+
+// HandleDAVPut creates or replaces a task from a VTODO. A new resource keeps the name and
+// UID chosen by the client. STATUS:COMPLETED completes the task like the status endpoint:
+// a recurring task moves on to its next date.
+func (h *Handler) HandleDAVPut(w http.ResponseWriter, r *http.Request) {
+	components, err := parseICS(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(components) != 1 || components[0].Name != componentTodo {
+		writeError(w, errForbidden("A resource must hold exactly one VTODO"))
+		return
+	}
+	todo := components[0]
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	object, err := h.Repo.CalDAVObject(name)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if r.Header.Get("If-Match") != "" {
+			writeError(w, repository.ErrVersionMismatch)
+			return
+		}
+		h.createDAVTask(w, r, name, todo)
+	case err != nil:
+		writeError(w, err)
+	case r.Header.Get("If-None-Match") == "*":
+		writeError(w, repository.ErrVersionMismatch)
+	default:
+		h.updateDAVTask(w, r, object, version, todo)
+	}
+}
+
+func (h *Handler) createDAVTask(w http.ResponseWriter, r *http.Request, name string, todo icsComponent) {
+	// "<id>.ics" names the tasks that no client named, so new resources cannot use it.
+	if id, ok := strings.CutSuffix(name, ".ics"); ok {
+		if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+			writeError(w, errForbidden("Resource names of the form <id>.ics are reserved"))
+			return
+		}
+	}
+	task := &repository.Task{}
+	if _, err := readComponent(todo, task); err != nil {
+		writeError(w, err)
+		return
+	}
+	if todo.Props["STATUS"].Value == "IN-PROCESS" {
+		task.Status = repository.StatusInProgress
+	}
+	if err := applyDateRules(task); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Without a UID of its own the task gets the one of its ID when it is served.
+	uid := unescapeText(todo.Props["UID"].Value)
+	completed := todo.Props["STATUS"].Value == "COMPLETED"
+	if _, err := h.Repo.InsertCalDAVTask(r.Context(), task, name, uid, completed); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(task.Version))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// updateDAVTask applies the VTODO like a PATCH of every field it carries, so that the date
+// rules only apply when the date or the repeat rule changed.
+func (h *Handler) updateDAVTask(w http.ResponseWriter, r *http.Request, object *repository.CalDAVObject, version int64, todo icsComponent) {
+	current := object.Task
+	updated := *current
+	if _, err := readComponent(todo, &updated); err != nil {
+		writeError(w, err)
+		return
+	}
+	patch := repository.TaskPatch{
+		Title:    &updated.Title,
+		Comment:  &updated.Comment,
+		Priority: &updated.Priority,
+		Tags:     updated.Tags,
+		Version:  version,
+	}
+	if updated.Date != current.Date || updated.Repeat != current.Repeat {
+		if err := applyDateRules(&updated); err != nil {
+			writeError(w, err)
+			return
+		}
+		patch.Date, patch.Repeat = &updated.Date, &updated.Repeat
+	}
+	// Clients only know whether a to-do is open, in process or completed; an open task
+	// keeps its status if it is already todo or waiting.
+	complete := false
+	switch todo.Props["STATUS"].Value {
+	case "IN-PROCESS":
+		updated.Status = repository.StatusInProgress
+		patch.Status = &updated.Status
+	case "COMPLETED":
+		complete = current.Status != repository.StatusDone
+	default:
+		if current.Status == repository.StatusInProgress || current.Status == repository.StatusDone {
+			updated.Status = repository.StatusTodo
+			patch.Status = &updated.Status
+		}
+	}
+
+	taskID, _ := strconv.ParseInt(current.ID, 10, 64)
+	version, err := h.Repo.UpdateCalDAVTask(r.Context(), taskID, &patch, complete)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDAVDelete moves a task to the trash.
+func (h *Handler) HandleDAVDelete(w http.ResponseWriter, r *http.Request) {
+	object, err := h.Repo.CalDAVObject(chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, _ := strconv.ParseInt(object.Task.ID, 10, 64)
+	if _, err = h.Repo.DeleteTask(r.Context(), id, version); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davPropNames lists the properties a PROPFIND or REPORT asks for. A missing list
+// (allprop) selects every property except calendar-data.
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type davFilter struct {
+	Comps []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type davCompFilter struct {
+	Name  string          `xml:"name,attr"`
+	Comps []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// matchesTodo tells whether a calendar-query filter admits VTODO components.
+func (f davFilter) matchesTodo() bool {
+	for _, calendar := range f.Comps {
+		for _, comp := range calendar.Comps {
+			if comp.Name != componentTodo {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// davResponse is one resource of a multistatus. Props holds the XML content of each
+// property found; status, if set, replaces the properties, e.g. for missing resources.
+type davResponse struct {
+	href    string
+	props   map[xml.Name]string
+	missing []xml.Name
+	status  int
+}
+
+// selectProps picks the requested properties out of the available ones.
+func selectProps(href string, available map[xml.Name]func() string, requested *davPropNames) davResponse {
+	response := davResponse{href: href, props: map[xml.Name]string{}}
+	if requested == nil {
+		for name, value := range available {
+			if name != (xml.Name{Space: nsCalDAV, Local: "calendar-data"}) {
+				response.props[name] = value()
+			}
+		}
+		return response
+	}
+	for _, prop := range requested.Names {
+		if value, ok := available[prop.XMLName]; ok {
+			response.props[prop.XMLName] = value()
+		} else {
+			response.missing = append(response.missing, prop.XMLName)
+		}
+	}
+	return response
+}
+
+func davName(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+func davHref(href string) string {
+	return "<d:href>" + xmlEscape(href) + "</d:href>"
+}
+
+func homeResponse(requested *davPropNames) davResponse {
+	return selectProps(davHome, map[xml.Name]func() string{
+		davName(nsDAV, "resourcetype"):           func() string { return "<d:collection/><d:principal/>" },
+		davName(nsDAV, "displayname"):            func() string { return "final_project" },
+		davName(nsDAV, "current-user-principal"): func() string { return davHref(davHome) },
+		davName(nsDAV, "principal-URL"):          func() string { return davHref(davHome) },
+		davName(nsCalDAV, "calendar-home-set"):   func() string { return davHref(davHome) },
+	}, requested)
+}
+
+func (h *Handler) calendarResponse(r *http.Request, requested *davPropNames) (davResponse, error) {
+	ctag, err := h.Repo.CalDAVCTag()
+	if err != nil {
+		return davResponse{}, err
+	}
+	privileges := "<d:privilege><d:read/></d:privilege>"
+	if token, ok := r.Context().Value(apiTokenKey).(*repository.APIToken); !ok || token.HasScope(repository.ScopeWrite) {
+		privileges += "<d:privilege><d:write/></d:privilege>"
+	}
+	return selectProps(davCalendar, map[xml.Name]func() string{
+		davName(nsDAV, "resourcetype"):                        func() string { return "<d:collection/><c:calendar/>" },
+		davName(nsDAV, "displayname"):                         func() string { return "Задачи" },
+		davName(nsDAV, "current-user-principal"):              func() string { return davHref(davHome) },
+		davName(nsDAV, "current-user-privilege-set"):          func() string { return privileges },
+		davName(nsCalDAV, "supported-calendar-component-set"): func() string { return `<c:comp name="VTODO"/>` },
+		davName(nsCS, "getctag"):                              func() string { return ctag },
+		davName(nsDAV, "supported-report-set"): func() string {
+			return "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>"
+		},
+	}, requested), nil
+}
+
+func (h *Handler) taskResponse(object *repository.CalDAVObject, requested *davPropNames) davResponse {
+	return selectProps(davCalendar+object.Name, map[xml.Name]func() string{
+		davName(nsDAV, "resourcetype"):     func() string { return "" },
+		davName(nsDAV, "getetag"):          func() string { return xmlEscape(etag(object.Task.Version)) },
+		davName(nsDAV, "getcontenttype"):   func() string { return "text/calendar; charset=utf-8; component=VTODO" },
+		davName(nsCalDAV, "calendar-data"): func() string { return xmlEscape(string(calendarData(object))) },
+	}, requested)
+}
+
+// calendarData is a task as an iCalendar object with a single VTODO.
+func calendarData(object *repository.CalDAVObject) []byte {
+	uid := object.UID
+	if uid == "" {
+		uid = taskUID(object.Task.ID)
+	}
+	var buf bytes.Buffer
+	ics := newICSWriter(&buf)
+	ics.begin()
+	ics.task(componentTodo, object.Task, uid, time.Now())
+	ics.end()
+	ics.Flush()
+	return buf.Bytes()
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + nsCalDAV + `" xmlns:cs="` + nsCS + `">`)
+	for _, response := range responses {
+		buf.WriteString("<d:response>" + davHref(response.href))
+		if response.status != 0 {
+			buf.WriteString(davStatus(response.status) + "</d:response>")
+			continue
+		}
+		names := make([]xml.Name, 0, len(response.props))
+		for name := range response.props {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return names[i].Local < names[j].Local })
+		buf.WriteString("<d:propstat><d:prop>")
+		for _, name := range names {
+			fmt.Fprintf(&buf, `<%s xmlns="%s">%s</%s>`, name.Local, name.Space, response.props[name], name.Local)
+		}
+		buf.WriteString("</d:prop>" + davStatus(http.StatusOK) + "</d:propstat>")
+		if len(response.missing) > 0 {
+			buf.WriteString("<d:propstat><d:prop>")
+			for _, name := range response.missing {
+				fmt.Fprintf(&buf, `<%s xmlns="%s"/>`, name.Local, xmlEscape(name.Space))
+			}
+			buf.WriteString("</d:prop>" + davStatus(http.StatusNotFound) + "</d:propstat>")
+		}
+		buf.WriteString("</d:response>")
+	}
+	buf.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Error writing multistatus response: %s", err.Error())
+	}
+}
+
+func davStatus(status int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+func xmlEscape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// decodeDAVBody reads an XML request body into v; an empty body leaves v unchanged.
+func decodeDAVBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		return errInvalid("", "Error reading the request body: "+err.Error())
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err = xml.Unmarshal(body, v); err != nil {
+		return errInvalid("", "Error decoding the XML request: "+err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"final_project/repository"
+)
+
+// Checklist handlers answer with the whole task, so that clients get the new ETag
+// together with the updated checklist.
+
+func (h *Handler) HandleChecklistPOST(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var item repository.ChecklistItem
+	if err = json.NewDecoder(r.Body).Decode(&item); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	undo, err := h.Repo.AddChecklistItem(r.Context(), id, version, item.Title)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.sendChangedTask(w, http.StatusCreated, id, undo)
+}
+
+func (h *Handler) HandleChecklistPATCH(w http.ResponseWriter, r *http.Request) {
+	id, itemID, version, err := checklistTarget(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body struct {
+		Title *string `json:"title"`
+		Done  *bool   `json:"done"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	patch := repository.ChecklistPatch{Title: body.Title, Done: body.Done}
+	undo, err := h.Repo.UpdateChecklistItem(r.Context(), id, itemID, version, &patch)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.sendChangedTask(w, http.StatusOK, id, undo)
+}
+
+func (h *Handler) HandleChecklistDelete(w http.ResponseWriter, r *http.Request) {
+	id, itemID, version, err := checklistTarget(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	undo, err := h.Repo.DeleteChecklistItem(r.Context(), id, itemID, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.sendChangedTask(w, http.StatusOK, id, undo)
+}
+
+// checklistTarget reads the task ID, the item ID from the {item} route parameter
+// or ?item= and the If-Match version.
+func checklistTarget(r *http.Request) (int64, int64, int64, error) {
+	id, err := taskID(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	itemStr := chi.URLParam(r, "item")
+	if itemStr == "" {
+		itemStr = r.URL.Query().Get("item")
+	}
+	if itemStr == "" {
+		return 0, 0, 0, errInvalid("item", "The checklist item ID is not specified")
+	}
+	itemID, err := strconv.ParseInt(itemStr, 10, 64)
+	if err != nil {
+		return 0, 0, 0, errInvalid("item", "Invalid format of the checklist item ID")
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return id, itemID, version, nil
+}
+
+func (h *Handler) sendChangedTask(w http.ResponseWriter, status int, id int64, undo string) {
+	task, err := h.Repo.GetTask(int(id))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setUndoToken(w, undo)
+	sendTask(w, status, task)
+}
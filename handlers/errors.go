@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"final_project/repository"
+)
+
+// Error codes are part of the API: clients match on them, so do not rename.
+const (
+	codeValidation           = "validation_error"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeInternal             = "internal_error"
+)
+
+// httpError is for failures that are about the request rather than the domain,
+// such as missing credentials.
+type httpError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *httpError) Error() string { return e.message }
+
+func errUnauthorized(message string) error {
+	return &httpError{status: http.StatusUnauthorized, code: codeUnauthorized, message: message}
+}
+
+func errForbidden(message string) error {
+	return &httpError{status: http.StatusForbidden, code: codeForbidden, message: message}
+}
+
+func errInvalid(field, message string) error {
+	return repository.NewValidationError(field, message)
+}
+
+// writeError is the single place where errors become HTTP responses.
+// Unexpected errors are logged and hidden behind a generic message.
+func writeError(w http.ResponseWriter, err error) {
+	resp := Response{Error: err.Error()}
+	status := http.StatusInternalServerError
+
+	var httpErr *httpError
+	var validationErr *repository.ValidationError
+	switch {
+	case errors.As(err, &httpErr):
+		status, resp.Code = httpErr.status, httpErr.code
+	case errors.As(err, &validationErr):
+		status, resp.Code, resp.Field = http.StatusBadRequest, codeValidation, validationErr.Field
+	case errors.Is(err, repository.ErrValidation):
+		status, resp.Code = http.StatusBadRequest, codeValidation
+	case errors.Is(err, repository.ErrNotFound):
+		status, resp.Code = http.StatusNotFound, codeNotFound
+	case errors.Is(err, repository.ErrVersionMismatch):
+		status, resp.Code = http.StatusPreconditionFailed, codePreconditionFailed
+	case errors.Is(err, repository.ErrConflict):
+		status, resp.Code = http.StatusConflict, codeConflict
+	default:
+		log.Printf("Error: %s", err)
+		resp.Error, resp.Code = "Internal Server Error", codeInternal
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error writing error response: %s", err.Error())
+	}
+}
+
+func HandleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, &httpError{
+		status:  http.StatusMethodNotAllowed,
+		code:    codeMethodNotAllowed,
+		message: "Method Not Allowed",
+	})
+}
+
+func HandleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, &httpError{
+		status:  http.StatusNotFound,
+		code:    codeNotFound,
+		message: "Not Found",
+	})
+}
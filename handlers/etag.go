@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"final_project/repository"
+)
+
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// listedTask is a task of a list. A list has no ETag header per task, so the ETag is in the
+// body, for clients that act on a task of the list without loading it first.
+type listedTask struct {
+	repository.Task
+	ETag string `json:"etag"`
+}
+
+func withETags(tasks []repository.Task) []listedTask {
+	listed := make([]listedTask, len(tasks))
+	for i, task := range tasks {
+		listed[i] = listedTask{Task: task, ETag: etag(task.Version)}
+	}
+	return listed
+}
+
+// ifMatchVersion returns the task version named by the If-Match header,
+// or 0 when the header is absent or "*" and any version may be overwritten.
+// The task routes require the header with RequireIfMatch.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	value = strings.TrimPrefix(value, "W/")
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errInvalid("If-Match", "If-Match must hold a single task ETag")
+	}
+	return version, nil
+}
+
+// RequireIfMatch rejects writes that do not say which version they are based on,
+// so that a client cannot silently overwrite a change it has not seen.
+func RequireIfMatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") == "" {
+			writeError(w, &httpError{
+				status:  http.StatusPreconditionRequired,
+				code:    codePreconditionRequired,
+				message: "The If-Match header is required",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"final_project/repository"
+)
+
+// Formats of exported and imported files.
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// csvColumns are the columns of a CSV export. Tags and prerequisites are comma-separated.
+var csvColumns = []string{"id", "date", "title", "comment", "repeat", "priority", "estimate", "status", "tags", "depends_on"}
+
+// fileFormat reads the format parameter. Without it a CSV Content-Type selects CSV and
+// anything else JSON.
+func fileFormat(r *http.Request) (string, error) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "":
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			return formatCSV, nil
+		}
+		return formatJSON, nil
+	case formatJSON, formatCSV:
+		return format, nil
+	}
+	return "", errInvalid("format", "The format must be 'json' or 'csv'")
+}
+
+// HandleExport streams every task. Query parameter: format, json (the default) for an object
+// with the tasks, including their checklists, and the completion history, or csv for one row
+// per task with the csvColumns. Errors after the response has started can only be logged.
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	format, err := fileFormat(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks-%s.%s"`, time.Now().Format(timeLayout), format))
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	if err = ExportTasks(w, h.Repo, format); err != nil {
+		log.Printf("Error exporting tasks: %s", err.Error())
+	}
+}
+
+// ExportTasks writes every task in the format of HandleExport, "json" or "csv".
+func ExportTasks(w io.Writer, repo *repository.Repository, format string) error {
+	switch format {
+	case formatJSON:
+		return exportJSON(w, repo)
+	case formatCSV:
+		return exportCSV(w, repo)
+	}
+	return errInvalid("format", "The format must be 'json' or 'csv'")
+}
+
+func exportJSON(w io.Writer, repo *repository.Repository) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	fmt.Fprintf(bw, `{"exported_at":%q,"tasks":[`, time.Now().UTC().Format(time.RFC3339))
+	separator := "\n"
+	err := repo.ExportTasks(func(task *repository.Task) error {
+		bw.WriteString(separator)
+		separator = ","
+		return enc.Encode(task)
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("],\"completions\":[")
+	separator = "\n"
+	err = repo.EachCompletion(func(completion *repository.Completion) error {
+		bw.WriteString(separator)
+		separator = ","
+		return enc.Encode(completion)
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("]}\n")
+	return bw.Flush()
+}
+
+func exportCSV(w io.Writer, repo *repository.Repository) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	err := repo.ExportTasks(func(task *repository.Task) error {
+		return cw.Write([]string{
+			task.ID, task.Date, task.Title, task.Comment, task.Repeat,
+			strconv.Itoa(task.Priority), strconv.Itoa(task.Estimate), task.Status,
+			strings.Join(task.Tags, ","), strings.Join(task.DependsOn, ","),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// importRow is a task read from an import file, or the error that kept it from being read.
+// Its ID is the one in the file, which the prerequisites of other rows refer to.
+type importRow struct {
+	task *repository.Task
+	err  error
+}
+
+// ImportResult reports the outcome of an import, row by row.
+type ImportResult struct {
+	DryRun   bool         `json:"dry_run"`
+	Imported int          `json:"imported"`
+	Skipped  int          `json:"skipped"`
+	Failed   int          `json:"failed"`
+	Items    []ImportItem `json:"items"`
+}
+
+// HandleImport imports a file sent as the request body with ImportTasks. Query parameters:
+// format (json or csv, by default from the Content-Type) and dry_run (true) to only
+// validate the rows.
+func (h *Handler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	format, err := fileFormat(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, errInvalid("", "Error reading the request body: "+err.Error()))
+		return
+	}
+	result, err := ImportTasks(r.Context(), h.Repo, data, format, dryRun)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// ImportTasks creates tasks from a JSON or CSV file in the format of ExportTasks (a bare
+// JSON array of tasks also works). Every row is checked by the rules of new tasks and gets
+// its own result. Rows with the title, repeat rule and date of a task in the database or of
+// an earlier row are skipped as duplicates. Prerequisites are mapped to the tasks imported
+// from the file; the completion history is not imported. Tasks keep their status, done
+// included. The import runs in one transaction, which a dry run rolls back.
+func ImportTasks(ctx context.Context, repo *repository.Repository, data []byte, format string, dryRun bool) (*ImportResult, error) {
+	var rows []importRow
+	var err error
+	switch format {
+	case formatJSON:
+		rows, err = parseJSONImport(data)
+	case formatCSV:
+		rows, err = parseCSVImport(data)
+	default:
+		err = errInvalid("format", "The format must be 'json' or 'csv'")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{DryRun: dryRun, Items: make([]ImportItem, 0, len(rows))}
+	err = repo.Import(ctx, dryRun, func(tasks *repository.TaskImport) error {
+		run := taskImport{tasks: tasks, ids: map[string]string{}, keys: map[string]string{}}
+		dependsOn := make([][]string, len(rows))
+		for i, row := range rows {
+			item := ImportItem{Index: i}
+			err := row.err
+			if err == nil {
+				dependsOn[i] = row.task.DependsOn
+				err = run.insert(row.task, &item)
+			}
+			if err != nil {
+				item.Status = importFailed
+				var validationErr *repository.ValidationError
+				if errors.As(err, &validationErr) {
+					item.Error, item.Field = validationErr.Error(), validationErr.Field
+				} else {
+					log.Printf("Error importing row %d: %s", i, err)
+					item.Error = "Internal Server Error"
+				}
+			}
+			result.Items = append(result.Items, item)
+		}
+		for i := range result.Items {
+			if item := &result.Items[i]; item.Status == importImported && len(dependsOn[i]) > 0 {
+				run.linkDependencies(item, dependsOn[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Items {
+		item := &result.Items[i]
+		switch item.Status {
+		case importImported:
+			result.Imported++
+		case importSkipped:
+			result.Skipped++
+		default:
+			result.Failed++
+		}
+		// The tasks of a dry run are rolled back, so their IDs do not exist.
+		if dryRun && item.Status == importImported {
+			item.ID = ""
+		}
+	}
+	return result, nil
+}
+
+// taskImport keeps the state of one import.
+type taskImport struct {
+	tasks *repository.TaskImport
+	// ids maps the IDs in the file to the tasks they became: imported ones or the tasks
+	// they duplicate.
+	ids map[string]string
+	// keys maps the title, repeat rule and date of the imported rows to their tasks.
+	keys map[string]string
+}
+
+// insert validates a row and, unless it is a duplicate, adds the task.
+func (imp *taskImport) insert(task *repository.Task, item *ImportItem) error {
+	item.Title = task.Title
+	fileID, fileDate := task.ID, task.Date
+	task.ID, task.DependsOn = "", nil
+	for i := range task.Checklist {
+		task.Checklist[i].ID = ""
+	}
+	if err := validateNewTask(task); err != nil {
+		return err
+	}
+
+	key := task.Title + "\x00" + task.Repeat + "\x00" + task.Date
+	if id, ok := imp.keys[key]; ok {
+		item.Status, item.Warning = importSkipped, "Duplicate of an earlier row"
+		imp.mapID(fileID, id)
+		return nil
+	}
+	duplicate, err := imp.tasks.FindDuplicate(task.Title, task.Repeat, fileDate, task.Date)
+	if err != nil {
+		return err
+	}
+	if duplicate != "" {
+		item.Status, item.Warning = importSkipped, "Duplicate of task "+duplicate
+		imp.mapID(fileID, duplicate)
+		return nil
+	}
+
+	id, err := imp.tasks.InsertTask(task)
+	if err != nil {
+		return err
+	}
+	item.ID = strconv.FormatInt(id, 10)
+	item.Status, item.Repeat = importImported, task.Repeat
+	imp.keys[key] = item.ID
+	imp.mapID(fileID, item.ID)
+	return nil
+}
+
+func (imp *taskImport) mapID(fileID, id string) {
+	if fileID != "" {
+		imp.ids[fileID] = id
+	}
+}
+
+// linkDependencies sets the prerequisites of an imported task once every row is in.
+// Prerequisites that are not in the file are dropped with a warning.
+func (imp *taskImport) linkDependencies(item *ImportItem, dependsOn []string) {
+	var linked, missing []string
+	for _, fileID := range dependsOn {
+		if id, ok := imp.ids[fileID]; ok {
+			linked = append(linked, id)
+		} else {
+			missing = append(missing, fileID)
+		}
+	}
+	if len(missing) > 0 {
+		item.Warning = "Prerequisites missing from the file are dropped: " + strings.Join(missing, ", ")
+	}
+	if len(linked) == 0 {
+		return
+	}
+	id, _ := strconv.ParseInt(item.ID, 10, 64)
+	if err := imp.tasks.SetDependencies(id, linked); err != nil {
+		log.Printf("Error setting the prerequisites of task %d: %s", id, err)
+		item.Warning = "The prerequisites could not be set: " + err.Error()
+	}
+}
+
+// parseJSONImport reads the tasks of an export or a bare array of tasks. A task that does
+// not decode fails on its own.
+func parseJSONImport(data []byte) ([]importRow, error) {
+	var file struct {
+		Tasks []json.RawMessage `json:"tasks"`
+	}
+	var err error
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &file.Tasks)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, errInvalid("", "Error decoding the JSON file: "+err.Error())
+	}
+	rows := make([]importRow, 0, len(file.Tasks))
+	for _, raw := range file.Tasks {
+		var task repository.Task
+		if err = json.Unmarshal(raw, &task); err != nil {
+			rows = append(rows, importRow{err: errInvalid("", "Error decoding the task: "+err.Error())})
+			continue
+		}
+		rows = append(rows, importRow{task: &task})
+	}
+	return rows, nil
+}
+
+// parseCSVImport reads a CSV file whose header names the columns, in any order; only
+// title is required and unknown columns are ignored.
+func parseCSVImport(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errInvalid("", "The CSV file has no header")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errInvalid("", "The CSV header has no 'title' column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, errInvalid("", "Error reading the CSV file: "+err.Error())
+		}
+		rows = append(rows, taskFromRecord(columns, record))
+	}
+}
+
+func taskFromRecord(columns map[string]int, record []string) importRow {
+	get := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	task := &repository.Task{
+		ID:        get("id"),
+		Date:      get("date"),
+		Title:     get("title"),
+		Comment:   get("comment"),
+		Repeat:    get("repeat"),
+		Status:    get("status"),
+		Tags:      splitList(get("tags")),
+		DependsOn: splitList(get("depends_on")),
+	}
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"priority", &task.Priority}, {"estimate", &task.Estimate}} {
+		value := get(field.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return importRow{err: errInvalid(field.name, fmt.Sprintf("Invalid %s: %s", field.name, value))}
+		}
+		*field.value = n
+	}
+	return importRow{task: task}
+}
+
+// splitList splits a comma-separated cell, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -7,22 +7,39 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi"
+
 	"final_project/repository"
 	"final_project/taskRepRules"
 )
 
 type Handler struct {
-	Repo *repository.Repository
+	Repo     *repository.Repository
+	Password string
+	// PasswordHash, set with the reset-password command, takes the place of Password.
+	PasswordHash string
+	// SessionSecret signs the web UI sessions; reset-password replaces it.
+	SessionSecret string
+	// DailyCapacity is the work in minutes that fits into a day; zero means no limit.
+	DailyCapacity int
+	// BackupDir receives the database backups, of which the BackupKeep newest are kept;
+	// zero keeps them all.
+	BackupDir  string
+	BackupKeep int
 }
 
 type Response struct {
 	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Field string `json:"field,omitempty"`
 }
 
 const timeLayout = "20060102"
 const maxTasksPerPage = 50
+const maxTasksLimit = 500
 
 func HandleNextDate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -30,30 +47,30 @@ func HandleNextDate() http.HandlerFunc {
 		dateStr := r.FormValue("date")
 		repeat := r.FormValue("repeat")
 		if nowStr == "" {
-			http.Error(w, "Missing 'now' parameter", http.StatusBadRequest)
+			writeError(w, errInvalid("now", "Missing 'now' parameter"))
 			return
 		}
 		if dateStr == "" {
-			http.Error(w, "Missing 'date' parameter", http.StatusBadRequest)
+			writeError(w, errInvalid("date", "Missing 'date' parameter"))
 			return
 		}
 		if repeat == "" {
-			http.Error(w, "Missing 'repeat' parameter", http.StatusBadRequest)
+			writeError(w, errInvalid("repeat", "Missing 'repeat' parameter"))
 			return
 		}
 		now, err := time.Parse(timeLayout, nowStr)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid 'now' format: %s", err), http.StatusBadRequest)
+			writeError(w, errInvalid("now", fmt.Sprintf("Invalid 'now' format: %s", err)))
 			return
 		}
 		_, err = time.Parse(timeLayout, dateStr)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid 'date' format: %s", err), http.StatusBadRequest)
+			writeError(w, errInvalid("date", fmt.Sprintf("Invalid 'date' format: %s", err)))
 			return
 		}
 		nextDate, err := taskRepRules.NextDate(now, dateStr, repeat)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error calculating next date: %s", err), http.StatusBadRequest)
+			writeError(w, errInvalid("repeat", fmt.Sprintf("Error calculating next date: %s", err)))
 			return
 		}
 		_, err = fmt.Fprintln(w, nextDate)
@@ -66,27 +83,52 @@ func HandleNextDate() http.HandlerFunc {
 }
 
 func (h *Handler) HandleTaskPOST(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	task, err := decodeNewTask(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id, undo, err := h.Repo.InsertTask(r.Context(), task)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	setUndoToken(w, undo)
+	sendSuccessResponse(w, id)
+}
+
+// decodeNewTask reads a task from the request body and applies the creation rules of
+// validateNewTask.
+func decodeNewTask(r *http.Request) (*repository.Task, error) {
 	var task repository.Task
 	err := json.NewDecoder(r.Body).Decode(&task)
 	if err != nil {
-		sendErrorResponse(w, "Error decoding JSON request: "+err.Error())
-		return
+		return nil, errInvalid("", "Error decoding JSON request: "+err.Error())
 	}
+	if err = validateNewTask(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// validateNewTask applies the creation rules: the title is required, past or missing
+// dates become today and the repeat rule must be valid.
+func validateNewTask(task *repository.Task) error {
 	if task.Title == "" {
-		sendErrorResponse(w, "The task title is not specified")
-		return
+		return errInvalid("title", "The task title is not specified")
+	}
+	if err := checkPriority(task.Priority); err != nil {
+		return err
+	}
+	if err := checkEstimate(task.Estimate); err != nil {
+		return err
 	}
 	if task.Date != "" {
-		_, err = time.Parse(timeLayout, task.Date)
+		parsedDate, err := time.Parse(timeLayout, task.Date)
 		if err != nil {
-			sendErrorResponse(w, "Invalid 'date' format")
-			return
+			return errInvalid("date", "Invalid 'date' format")
 		}
-		parsedDate, _ := time.Parse(timeLayout, task.Date)
 		if parsedDate.Before(time.Now()) {
 			task.Date = time.Now().Format(timeLayout)
 		}
@@ -94,136 +136,246 @@ func (h *Handler) HandleTaskPOST(w http.ResponseWriter, r *http.Request) {
 		task.Date = time.Now().Format(timeLayout)
 	}
 	if task.Repeat != "" {
-		_, err = taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
+		_, err := taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
 		if err != nil {
-			sendErrorResponse(w, err.Error())
-			return
+			return errInvalid("repeat", err.Error())
 		}
 	}
+	return nil
+}
 
-	id, err := h.Repo.InsertTask(&task)
+// HandleTasksGET lists tasks page by page. Query parameters: date, from, to,
+// due (overdue, today, week), repeat (none, recurring), status (comma-separated),
+// tags (comma-separated) with tag_mode (any, all), min_priority, high_priority (true),
+// sort (date, title, created, priority), order (asc, desc), limit and cursor,
+// the next_cursor of the previous page.
+// Tasks of the same date are ordered by priority, highest first. Each task carries its ETag.
+func (h *Handler) HandleTasksGET(w http.ResponseWriter, r *http.Request) {
+	query, err := parseTaskQuery(r)
 	if err != nil {
-		sendErrorResponse(w, "Error inserting task: "+err.Error())
+		writeError(w, err)
 		return
 	}
-	sendSuccessResponse(w, id)
-}
 
-func (h *Handler) HandleTasksGET(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	tasks, next, err := h.Repo.GetTasks(query)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	resp := map[string]interface{}{"tasks": withETags(tasks)}
+	if next != "" {
+		resp["next_cursor"] = next
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
 
-	dateStr := r.URL.Query().Get("date")
-	var date time.Time
+func parseTaskQuery(r *http.Request) (repository.TaskQuery, error) {
+	params := r.URL.Query()
+	query := repository.TaskQuery{
+		Repeat:  params.Get("repeat"),
+		TagMode: params.Get("tag_mode"),
+		Sort:    params.Get("sort"),
+		Cursor:  params.Get("cursor"),
+		Limit:   maxTasksPerPage,
+	}
+	for _, value := range params["tags"] {
+		query.Tags = append(query.Tags, strings.Split(value, ",")...)
+	}
+	for _, value := range params["status"] {
+		query.Statuses = append(query.Statuses, strings.Split(value, ",")...)
+	}
 	var err error
-	if dateStr != "" {
-		date, err = time.Parse(timeLayout, dateStr)
+	if dateStr := params.Get("date"); dateStr != "" {
+		query.Date, err = time.Parse(timeLayout, dateStr)
 		if err != nil {
-			sendErrResponse(w, "Invalid date format: "+err.Error())
-			return
+			return query, errInvalid("date", "Invalid date format: "+err.Error())
 		}
 	}
-
-	tasks, err := h.Repo.GetTasks(date, maxTasksPerPage)
-	if err != nil {
-		sendErrResponse(w, "Error getting tasks: "+err.Error())
-		return
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if value := params.Get(bound.name); value != "" {
+			*bound.value, err = time.Parse(timeLayout, value)
+			if err != nil {
+				return query, errInvalid(bound.name, "Invalid date format: "+err.Error())
+			}
+		}
 	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks}); err != nil {
-		sendErrResponse(w, "Error encoding response: "+err.Error())
-		return
+	if due := params.Get("due"); due != "" {
+		from, to, err := dueRange(due, time.Now())
+		if err != nil {
+			return query, err
+		}
+		if query.From.IsZero() || from.After(query.From) {
+			query.From = from
+		}
+		if query.To.IsZero() || (!to.IsZero() && to.Before(query.To)) {
+			query.To = to
+		}
 	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, errInvalid("order", "The order must be 'asc' or 'desc'")
+	}
+	if value := params.Get("min_priority"); value != "" {
+		query.MinPriority, err = strconv.Atoi(value)
+		if err != nil || checkPriority(query.MinPriority) != nil {
+			return query, errInvalid("min_priority", fmt.Sprintf("The priority must be a number from 0 to %d", repository.MaxPriority))
+		}
+	}
+	if value := params.Get("high_priority"); value != "" {
+		high, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, errInvalid("high_priority", "The high_priority filter must be 'true' or 'false'")
+		}
+		if high && query.MinPriority < repository.PriorityHigh {
+			query.MinPriority = repository.PriorityHigh
+		}
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		query.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || query.Limit < 1 || query.Limit > maxTasksLimit {
+			return query, errInvalid("limit", fmt.Sprintf("The limit must be a number from 1 to %d", maxTasksLimit))
+		}
+	}
+	return query, nil
+}
+
+// dueRange turns a due filter into an inclusive date range; a zero time is an open end.
+func dueRange(due string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch due {
+	case "overdue":
+		return time.Time{}, today.AddDate(0, 0, -1), nil
+	case "today":
+		return today, today, nil
+	case "week":
+		monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		return monday, monday.AddDate(0, 0, 6), nil
+	}
+	return time.Time{}, time.Time{}, errInvalid("due", "The due filter must be 'overdue', 'today' or 'week'")
 }
 
 func (h *Handler) HandleTaskGET(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	idParam := r.URL.Query().Get("id")
-	if idParam == "" {
-		sendErrorResponse(w, "The ID is not specified")
-		return
-	}
-	id, err := strconv.Atoi(idParam)
+	id, err := taskID(r)
 	if err != nil {
-		sendErrorResponse(w, "Invalid ID format")
+		writeError(w, err)
 		return
 	}
 
-	task, err := h.Repo.GetTask(id)
+	task, err := h.Repo.GetTask(int(id))
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	err = json.NewEncoder(w).Encode(task)
-	if err != nil {
-		sendErrorResponse(w, "Error encoding response: "+err.Error())
-		return
+	w.Header().Set("ETag", etag(task.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(task); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
 	}
 }
 
-func (h *Handler) HandlerMarkTaskDone(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		http.Error(w, "The task ID is not specified", http.StatusBadRequest)
-		return
-	}
-	id, err := strconv.ParseInt(idStr, 10, 64)
+func (h *Handler) HandleTaskPUT(w http.ResponseWriter, r *http.Request) {
+	task, err := decodeTaskUpdate(r, "")
 	if err != nil {
-		http.Error(w, "Invalid format of the task ID", http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
-	err = h.Repo.MarkTaskDone(id)
+
+	undo, err := h.Repo.UpdateTask(r.Context(), task)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK) // Возвращаем статутс 200 ОК с сообщением об успехе
-	_, err = w.Write([]byte(`{"success": true, "message": "Task marked as done"}`))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	setUndoToken(w, undo)
+	w.Header().Set("ETag", etag(task.Version))
+	sendSuccessResp(w)
 }
 
-func (h *Handler) HandleTaskPUT(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// decodeTaskUpdate reads a full task replacement from the request body. pathID, when set,
+// is the ID from the URL and takes precedence over the one in the body.
+func decodeTaskUpdate(r *http.Request, pathID string) (*repository.TaskUpdate, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		sendErrorResponse(w, "Error reading the request body: "+err.Error())
-		return
+		return nil, errInvalid("", "Error reading the request body: "+err.Error())
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			sendErrorResponse(w, "Error closing the request body: "+err.Error())
-			return
-		}
-	}(r.Body)
+	defer r.Body.Close()
 
-	var task repository.Task
-	err = json.Unmarshal(body, &task)
+	var update repository.TaskUpdate
+	err = json.Unmarshal(body, &update)
 	if err != nil {
-		sendErrorResponse(w, "Error decoding the JSON request: "+err.Error())
-		return
+		return nil, errInvalid("", "Error decoding the JSON request: "+err.Error())
+	}
+	task := &update.Task
+	if pathID != "" {
+		if task.ID != "" && task.ID != pathID {
+			return nil, errInvalid("id", "The task ID in the body does not match the URL")
+		}
+		task.ID = pathID
+	}
+	if task.ID == "" {
+		return nil, errInvalid("id", "The task ID is not specified")
+	}
+	if _, err = strconv.ParseInt(task.ID, 10, 64); err != nil {
+		return nil, errInvalid("id", "Invalid format of the task ID")
 	}
 	if task.Title == "" {
-		sendErrorResponse(w, "The task title is not specified")
-		return
+		return nil, errInvalid("title", "The task title is not specified")
+	}
+	if update.Priority != nil {
+		if err = checkPriority(*update.Priority); err != nil {
+			return nil, err
+		}
+	}
+	if update.Estimate != nil {
+		if err = checkEstimate(*update.Estimate); err != nil {
+			return nil, err
+		}
+	}
+	if task.Version, err = ifMatchVersion(r); err != nil {
+		return nil, err
+	}
+	if err = applyDateRules(task); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+func checkPriority(priority int) error {
+	if priority < 0 || priority > repository.MaxPriority {
+		return errInvalid("priority", fmt.Sprintf("The priority must be a number from 0 to %d", repository.MaxPriority))
+	}
+	return nil
+}
+
+func checkEstimate(estimate int) error {
+	if estimate < 0 || estimate > repository.MaxEstimate {
+		return errInvalid("estimate", fmt.Sprintf("The estimate must be a number of minutes from 0 to %d", repository.MaxEstimate))
 	}
+	return nil
+}
+
+// applyDateRules validates the date and repeat rule of an edited task. A date in the past
+// moves to the next occurrence for recurring tasks and to today for one-off tasks.
+func applyDateRules(task *repository.Task) error {
 	if task.Date != "" {
 		parsedDate, err := time.Parse(timeLayout, task.Date)
 		if err != nil {
-			sendErrorResponse(w, "Invalid 'date' format")
-			return
+			return errInvalid("date", "Invalid 'date' format")
 		}
 
 		if parsedDate.Before(time.Now()) {
 			if task.Repeat != "" {
 				task.Date, err = taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
 				if err != nil {
-					sendErrorResponse(w, err.Error())
-					return
+					return errInvalid("repeat", err.Error())
 				}
 			} else {
 				task.Date = time.Now().Format(timeLayout)
@@ -234,82 +386,100 @@ func (h *Handler) HandleTaskPUT(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if task.Repeat != "" {
-		_, err = taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
+		_, err := taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
 		if err != nil {
-			sendErrorResponse(w, err.Error())
-			return
+			return errInvalid("repeat", err.Error())
 		}
 	}
-
-	rowsAffected, err := h.Repo.UpdateTask(&task)
-	if err != nil {
-		sendErrorResponse(w, err.Error())
-		return
-	}
-	if rowsAffected == 0 {
-		sendErrorResponse(w, "Task not found")
-		return
-	}
-	sendSuccessResp(w)
+	return nil
 }
 
 func (h *Handler) HandleTaskDone(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		sendErrorResponse(w, "The task ID is not specified")
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	force, err := forceParam(r)
 	if err != nil {
-		sendErrorResponse(w, "Invalid format of the task ID")
+		writeError(w, err)
 		return
 	}
-
-	err = h.Repo.MarkTaskDone(id)
+	undo, err := h.Repo.MarkTaskDone(r.Context(), id, version, force)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		writeError(w, err)
 		return
 	}
+	setUndoToken(w, undo)
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]interface{}{})
+	sendEmptyResponse(w)
+}
+
+// forceParam reads ?force=true, which completes a task even if its prerequisites are open.
+func forceParam(r *http.Request) (bool, error) {
+	return boolParam(r, "force")
+}
+
+// boolParam reads an optional boolean query parameter, false by default.
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
 	if err != nil {
-		sendErrorResponse(w, "Error encoding response: "+err.Error())
-		return
+		return false, errInvalid(name, fmt.Sprintf("The %s flag must be 'true' or 'false'", name))
 	}
+	return flag, nil
 }
 
 func (h *Handler) HandleTaskDelete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "DELETE" {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		sendErrorResponse(w, "The task ID is not specified")
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	undo, err := h.Repo.DeleteTask(r.Context(), id, version)
 	if err != nil {
-		sendErrorResponse(w, "Invalid format of the task ID")
+		writeError(w, err)
 		return
 	}
-	err = h.Repo.DeleteTask(id)
+	setUndoToken(w, undo)
+
+	sendEmptyResponse(w)
+}
+
+// taskID takes the task ID from the {id} route parameter or, on the legacy API, from ?id=.
+func taskID(r *http.Request) (int64, error) {
+	idStr := chi.URLParam(r, "id")
+	if idStr == "" {
+		idStr = r.URL.Query().Get("id")
+	}
+	if idStr == "" {
+		return 0, errInvalid("id", "The task ID is not specified")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
-		return
+		return 0, errInvalid("id", "Invalid format of the task ID")
 	}
+	return id, nil
+}
 
+func sendEmptyResponse(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{}); err != nil {
-		sendErrorResponse(w, "Error encoding response: "+err.Error())
-		return
+		log.Printf("Error writing JSON response: %s", err.Error())
 	}
 }
 
@@ -318,30 +488,7 @@ func sendSuccessResp(w http.ResponseWriter) {
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 	}); err != nil {
-		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-}
-
-func sendErrResponse(w http.ResponseWriter, message string) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusBadRequest)
-	errResponse := map[string]interface{}{"error": message}
-	err := json.NewEncoder(w).Encode(errResponse)
-	if err != nil {
-		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-}
-
-func sendErrorResponse(w http.ResponseWriter, err string) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusInternalServerError)
-
-	log.Printf("Error: %s", err)
-
-	if err := json.NewEncoder(w).Encode(Response{Error: "Internal Server Error"}); err != nil {
-		http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		log.Printf("Error writing JSON response: %s", err.Error())
 	}
 }
 
@@ -352,7 +499,7 @@ func sendSuccessResponse(w http.ResponseWriter, id int64) {
 		"id":      id,
 	})
 	if err != nil {
-		sendErrorResponse(w, "Error marshalling JSON response: "+err.Error())
+		writeError(w, fmt.Errorf("error marshalling JSON response: %w", err))
 		return
 	}
 
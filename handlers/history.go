@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// HandleTaskHistoryGET lists completions of one task, including tasks that no longer exist.
+func (h *Handler) HandleTaskHistoryGET(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.sendCompletions(w, r, id)
+}
+
+// HandleHistoryGET lists completions of all tasks.
+func (h *Handler) HandleHistoryGET(w http.ResponseWriter, r *http.Request) {
+	h.sendCompletions(w, r, 0)
+}
+
+func (h *Handler) sendCompletions(w http.ResponseWriter, r *http.Request, id int64) {
+	limit := maxTasksPerPage
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxTasksLimit {
+			writeError(w, errInvalid("limit", fmt.Sprintf("The limit must be a number from 1 to %d", maxTasksLimit)))
+			return
+		}
+	}
+
+	completions, err := h.Repo.GetCompletions(id, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"completions": completions}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"final_project/repository"
+	"final_project/taskRepRules"
+)
+
+// iCalendar component types a task can be exported as.
+const (
+	componentEvent = "VEVENT"
+	componentTodo  = "VTODO"
+)
+
+// icalPriorities maps task priorities to the iCalendar scale, where 1 is the highest
+// and 0 means undefined.
+var icalPriorities = []int{0, 6, 3, 1}
+
+// icalStatuses maps task statuses to VTODO statuses.
+var icalStatuses = map[string]string{
+	repository.StatusTodo:       "NEEDS-ACTION",
+	repository.StatusInProgress: "IN-PROCESS",
+	repository.StatusWaiting:    "NEEDS-ACTION",
+	repository.StatusDone:       "COMPLETED",
+}
+
+// FeedAuth lets calendar subscriptions, which cannot send headers, pass an API token
+// as ?token=. The token is checked by Auth like a bearer token.
+func (h *Handler) FeedAuth(next http.Handler) http.Handler {
+	auth := h.Auth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret := r.URL.Query().Get("token"); secret != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+secret)
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// HandleCalendarICS exports every task as an iCalendar feed. Query parameters: component
+// (vevent, the default, for all-day events or vtodo for to-dos) and token, a read API token.
+func (h *Handler) HandleCalendarICS(w http.ResponseWriter, r *http.Request) {
+	component := strings.ToUpper(r.URL.Query().Get("component"))
+	if component == "" {
+		component = componentEvent
+	}
+	if component != componentEvent && component != componentTodo {
+		writeError(w, errInvalid("component", "The component must be 'vevent' or 'vtodo'"))
+		return
+	}
+
+	// The tasks are read before writing, so that errors still get a JSON response.
+	var tasks []repository.Task
+	err := h.Repo.EachTask(repository.TaskQuery{}, func(task *repository.Task) error {
+		tasks = append(tasks, *task)
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	ics := newICSWriter(w)
+	ics.begin()
+	stamp := time.Now()
+	for i := range tasks {
+		ics.task(component, &tasks[i], taskUID(tasks[i].ID), stamp)
+	}
+	ics.end()
+	if err = ics.Flush(); err != nil {
+		log.Printf("Error writing iCalendar response: %s", err.Error())
+	}
+}
+
+// icsWriter writes iCalendar content lines. Write errors are kept by the buffer
+// and reported by Flush.
+type icsWriter struct {
+	*bufio.Writer
+}
+
+func newICSWriter(w io.Writer) icsWriter {
+	return icsWriter{bufio.NewWriter(w)}
+}
+
+func (w icsWriter) begin() {
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//final_project//Scheduler//RU")
+	w.line("CALSCALE:GREGORIAN")
+}
+
+func (w icsWriter) end() {
+	w.line("END:VCALENDAR")
+}
+
+// task writes the task as an all-day component. A VEVENT lasts its day, a VTODO is due on it.
+func (w icsWriter) task(component string, task *repository.Task, uid string, stamp time.Time) {
+	w.line("BEGIN:" + component)
+	w.line("UID:" + escapeText(uid))
+	w.line("DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"))
+	w.line("DTSTART;VALUE=DATE:" + task.Date)
+	if component == componentEvent {
+		if date, err := time.Parse(timeLayout, task.Date); err == nil {
+			w.line("DTEND;VALUE=DATE:" + date.AddDate(0, 0, 1).Format(timeLayout))
+		}
+	} else {
+		w.line("DUE;VALUE=DATE:" + task.Date)
+		w.line("STATUS:" + icalStatuses[task.Status])
+	}
+	w.line("SUMMARY:" + escapeText(task.Title))
+	if task.Comment != "" {
+		w.line("DESCRIPTION:" + escapeText(task.Comment))
+	}
+	if len(task.Tags) > 0 {
+		tags := make([]string, 0, len(task.Tags))
+		for _, tag := range task.Tags {
+			tags = append(tags, escapeText(tag))
+		}
+		w.line("CATEGORIES:" + strings.Join(tags, ","))
+	}
+	if task.Priority > 0 && task.Priority < len(icalPriorities) {
+		w.line(fmt.Sprintf("PRIORITY:%d", icalPriorities[task.Priority]))
+	}
+	if task.Repeat != "" {
+		rule, err := taskRepRules.RRule(task.Repeat)
+		if err != nil {
+			log.Printf("Task %s: the repeat rule is exported without RRULE: %s", task.ID, err)
+		} else {
+			w.line("RRULE:" + rule)
+		}
+	}
+	w.line(fmt.Sprintf("SEQUENCE:%d", task.Version-1))
+	w.line("END:" + component)
+}
+
+// line writes a content line folded at 75 octets without splitting UTF-8 characters.
+func (w icsWriter) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards its length.
+		limit = 74
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func taskUID(id string) string {
+	return "task-" + id + "@final_project"
+}
+
+// escapeText escapes a TEXT value as RFC 5545 requires.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
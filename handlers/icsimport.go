@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"final_project/repository"
+	"final_project/taskRepRules"
+)
+
+// maxImportSize limits the size of imported files.
+const maxImportSize = 10 << 20
+
+// Outcomes of importing one item.
+const (
+	importImported = "imported"
+	importSkipped  = "skipped"
+	importFailed   = "failed"
+)
+
+// icsComponent is a VEVENT or VTODO with its properties by name. Repeated properties
+// keep their first value; nested components such as VALARM are left out.
+type icsComponent struct {
+	Name  string
+	Props map[string]icsProperty
+}
+
+type icsProperty struct {
+	Params map[string]string
+	Value  string
+}
+
+// ImportItem reports what became of one imported component or row.
+type ImportItem struct {
+	Index   int    `json:"index"`
+	UID     string `json:"uid,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Status  string `json:"status"`
+	ID      string `json:"id,omitempty"`
+	Repeat  string `json:"repeat,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+// HandleICSImport creates tasks from the VEVENT and VTODO components of an iCalendar file
+// sent as the request body. DTSTART (or DUE of a to-do) becomes the date, SUMMARY and
+// DESCRIPTION the title and comment, CATEGORIES the tags and RRULE the closest supported
+// repeat rule. Every component gets its own result; completed to-dos and past one-off
+// events are skipped.
+func (h *Handler) HandleICSImport(w http.ResponseWriter, r *http.Request) {
+	components, err := parseICS(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items := make([]ImportItem, 0, len(components))
+	counts := map[string]int{importImported: 0, importSkipped: 0, importFailed: 0}
+	for i, component := range components {
+		item := ImportItem{
+			Index: i,
+			UID:   component.Props["UID"].Value,
+			Title: unescapeText(component.Props["SUMMARY"].Value),
+		}
+		task, err := taskFromComponent(component, &item)
+		var id int64
+		if err == nil && task != nil {
+			id, _, err = h.Repo.InsertTask(r.Context(), task)
+		}
+		switch {
+		case err != nil:
+			item.Status = importFailed
+			var validationErr *repository.ValidationError
+			if errors.As(err, &validationErr) {
+				item.Error, item.Field = validationErr.Error(), validationErr.Field
+			} else {
+				log.Printf("Error importing item %d: %s", i, err)
+				item.Error = "Internal Server Error"
+			}
+		case task == nil:
+			item.Status = importSkipped
+		default:
+			item.Status = importImported
+			item.ID = fmt.Sprintf("%d", id)
+			item.Repeat = task.Repeat
+		}
+		counts[item.Status]++
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": counts[importImported],
+		"skipped":  counts[importSkipped],
+		"failed":   counts[importFailed],
+		"items":    items,
+	})
+	if err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// taskFromComponent converts a component into a new task checked by the rules of edited
+// tasks, so that a recurring task that started in the past moves to its next date.
+// It returns a nil task, with the reason in item.Warning, for components that are skipped.
+func taskFromComponent(c icsComponent, item *ImportItem) (*repository.Task, error) {
+	task := &repository.Task{}
+	if c.Name == componentTodo {
+		switch c.Props["STATUS"].Value {
+		case "COMPLETED", "CANCELLED":
+			item.Warning = "The to-do is already " + strings.ToLower(c.Props["STATUS"].Value)
+			return nil, nil
+		case "IN-PROCESS":
+			task.Status = repository.StatusInProgress
+		}
+	}
+	warning, err := readComponent(c, task)
+	if err != nil {
+		return nil, err
+	}
+	item.Warning = warning
+	if task.Repeat == "" && c.Name == componentEvent && task.Date != "" && task.Date < time.Now().Format(timeLayout) {
+		item.Warning = "The event is in the past"
+		return nil, nil
+	}
+	if err = applyDateRules(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// readComponent copies the properties of a component onto the task, leaving the status
+// to the caller. Absent properties clear their fields, except that the date and, as few
+// clients know categories, the tags are kept. The warning tells if RRULE was approximated.
+func readComponent(c icsComponent, task *repository.Task) (string, error) {
+	task.Title = unescapeText(c.Props["SUMMARY"].Value)
+	if task.Title == "" {
+		return "", errInvalid("title", "The SUMMARY of the item is empty")
+	}
+	task.Comment = unescapeText(c.Props["DESCRIPTION"].Value)
+	if categories, ok := c.Props["CATEGORIES"]; ok {
+		task.Tags = splitText(categories.Value)
+		if task.Tags == nil {
+			task.Tags = []string{}
+		}
+	}
+	task.Priority = 0
+	if value := c.Props["PRIORITY"].Value; value != "" {
+		var priority int
+		if _, err := fmt.Sscan(value, &priority); err == nil {
+			task.Priority = fromICALPriority(priority)
+		}
+	}
+
+	start, ok := c.Props["DTSTART"]
+	if !ok && c.Name == componentTodo {
+		start = c.Props["DUE"]
+	}
+	if start.Value != "" {
+		if len(start.Value) < len(timeLayout) {
+			return "", errInvalid("date", "Invalid DTSTART: "+start.Value)
+		}
+		date := start.Value[:len(timeLayout)]
+		if _, err := time.Parse(timeLayout, date); err != nil {
+			return "", errInvalid("date", "Invalid DTSTART: "+start.Value)
+		}
+		task.Date = date
+	}
+
+	task.Repeat = ""
+	rule := c.Props["RRULE"].Value
+	if rule == "" {
+		return "", nil
+	}
+	repeat, exact, err := taskRepRules.FromRRule(rule)
+	if err != nil {
+		return "", errInvalid("repeat", err.Error())
+	}
+	task.Repeat = repeat
+	if !exact {
+		return fmt.Sprintf("RRULE %s is approximated by '%s'", rule, repeat), nil
+	}
+	return "", nil
+}
+
+// fromICALPriority reverses icalPriorities: 1 is the highest and 9 the lowest priority.
+func fromICALPriority(priority int) int {
+	switch {
+	case priority == 1:
+		return repository.MaxPriority
+	case priority >= 2 && priority <= 4:
+		return repository.PriorityHigh
+	case priority >= 5 && priority <= 9:
+		return 1
+	}
+	return 0
+}
+
+// parseICS reads the VEVENT and VTODO components of an iCalendar stream.
+func parseICS(r io.Reader) ([]icsComponent, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errInvalid("", "Error reading the iCalendar file: "+err.Error())
+	}
+	// Lines are unfolded first: a line starting with a space or tab continues the previous one.
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.NewReplacer("\n ", "", "\n\t", "").Replace(text)
+
+	var components []icsComponent
+	var current *icsComponent
+	depth := 0
+	seenCalendar := false
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(nil, maxImportSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		name, prop, ok := parseContentLine(line)
+		if !ok {
+			return nil, errInvalid("", "Invalid iCalendar line: "+line)
+		}
+		switch name {
+		case "BEGIN":
+			depth++
+			value := strings.ToUpper(prop.Value)
+			if depth == 1 && value == "VCALENDAR" {
+				seenCalendar = true
+			}
+			if depth == 2 && (value == componentEvent || value == componentTodo) {
+				current = &icsComponent{Name: value, Props: map[string]icsProperty{}}
+			}
+		case "END":
+			if depth == 2 && current != nil {
+				components = append(components, *current)
+				current = nil
+			}
+			depth--
+		default:
+			if depth == 2 && current != nil {
+				if _, exists := current.Props[name]; !exists {
+					current.Props[name] = prop
+				}
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errInvalid("", "Error reading the iCalendar file: "+err.Error())
+	}
+	if !seenCalendar {
+		return nil, errInvalid("", "The body is not an iCalendar file")
+	}
+	return components, nil
+}
+
+// parseContentLine splits "NAME;PARAM=value:VALUE". Parameter values may be quoted
+// and contain colons.
+func parseContentLine(line string) (string, icsProperty, bool) {
+	prop := icsProperty{Params: map[string]string{}}
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", prop, false
+	}
+	prop.Value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return strings.ToUpper(parts[0]), prop, true
+}
+
+// unescapeText reverses escapeText.
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// splitText splits a TEXT list at the commas that are not escaped.
+func splitText(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var items []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, unescapeText(s[start:]))
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"final_project/repository"
+)
+
+// HandleTaskPATCH applies a JSON Merge Patch (RFC 7396) to a task: only the fields
+// present in the body change, and null resets comment, repeat, priority, estimate, tags, checklist
+// or depends_on to empty. Date and repeat rules are re-checked only when one of them is part of the patch,
+// inside the write so that they see the task being changed.
+func (h *Handler) HandleTaskPATCH(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON merge patch: "+err.Error()))
+		return
+	}
+
+	var patch repository.TaskPatch
+	if patch.Version, err = ifMatchVersion(r); err != nil {
+		writeError(w, err)
+		return
+	}
+	for name, raw := range fields {
+		if err = patchField(&patch, id, name, raw); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	patch.DateRules = applyDateRules
+	task, undo, err := h.Repo.PatchTask(r.Context(), id, &patch)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setUndoToken(w, undo)
+	sendTask(w, http.StatusOK, task)
+}
+
+// patchField decodes one field of a merge patch into patch.
+func patchField(patch *repository.TaskPatch, id int64, name string, raw json.RawMessage) error {
+	switch name {
+	case "id":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		if value != nil && *value != "" && *value != strconv.FormatInt(id, 10) {
+			return errInvalid("id", "The task ID cannot be changed")
+		}
+	case "title":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		if value == nil || *value == "" {
+			return errInvalid("title", "The task title is not specified")
+		}
+		patch.Title = value
+	case "date":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return errInvalid("date", "The task date cannot be removed")
+		}
+		patch.Date = value
+	case "status":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return errInvalid("status", "The task status cannot be removed")
+		}
+		patch.Status = value
+	case "comment":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		patch.Comment = orEmpty(value)
+	case "repeat":
+		value, err := patchString(name, raw)
+		if err != nil {
+			return err
+		}
+		patch.Repeat = orEmpty(value)
+	case "priority":
+		if err := json.Unmarshal(raw, &patch.Priority); err != nil {
+			return errInvalid("priority", "The 'priority' field must be a number or null")
+		}
+		if patch.Priority == nil {
+			patch.Priority = new(int)
+		}
+		return checkPriority(*patch.Priority)
+	case "estimate":
+		if err := json.Unmarshal(raw, &patch.Estimate); err != nil {
+			return errInvalid("estimate", "The 'estimate' field must be a number of minutes or null")
+		}
+		if patch.Estimate == nil {
+			patch.Estimate = new(int)
+		}
+		return checkEstimate(*patch.Estimate)
+	case "tags":
+		if err := json.Unmarshal(raw, &patch.Tags); err != nil {
+			return errInvalid("tags", "The 'tags' field must be an array of strings or null")
+		}
+		if patch.Tags == nil {
+			patch.Tags = []string{}
+		}
+	case "depends_on":
+		if err := json.Unmarshal(raw, &patch.DependsOn); err != nil {
+			return errInvalid("depends_on", "The 'depends_on' field must be an array of task IDs or null")
+		}
+		if patch.DependsOn == nil {
+			patch.DependsOn = []string{}
+		}
+	case "checklist":
+		if err := json.Unmarshal(raw, &patch.Checklist); err != nil {
+			return errInvalid("checklist", "The 'checklist' field must be an array of items or null")
+		}
+		if patch.Checklist == nil {
+			patch.Checklist = []repository.ChecklistItem{}
+		}
+	default:
+		return errInvalid(name, "Unknown field: "+name)
+	}
+	return nil
+}
+
+// patchString decodes a field that holds a string or null.
+func patchString(name string, raw json.RawMessage) (*string, error) {
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errInvalid(name, "The '"+name+"' field must be a string or null")
+	}
+	return value, nil
+}
+
+func orEmpty(value *string) *string {
+	if value == nil {
+		empty := ""
+		return &empty
+	}
+	return value
+}
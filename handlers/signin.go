@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"final_project/repository"
+)
+
+// signInRequest is the body of POST /api/signin, where the web UI exchanges the password,
+// set with reset-password or TODO_PASSWORD, for a session cookie.
+type signInRequest struct {
+	Password string `json:"password"`
+}
+
+// sessionToken is what the web UI keeps in the "token" cookie after sign-in. It is signed
+// with the session secret, so it cannot be made from the stored hash alone, and it covers
+// the password, so changing either one invalidates old sessions.
+func sessionToken(secret, password string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("final_project session\x00"))
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hasPassword tells whether sign-in is required.
+func (h *Handler) hasPassword() bool {
+	return h.PasswordHash != "" || h.Password != ""
+}
+
+// checkPassword compares a password with the stored hash or, without one, TODO_PASSWORD.
+func (h *Handler) checkPassword(password string) bool {
+	if h.PasswordHash != "" {
+		return repository.VerifyPassword(h.PasswordHash, password)
+	}
+	return h.Password != "" && hmac.Equal([]byte(password), []byte(h.Password))
+}
+
+// session is the session token of the current password.
+func (h *Handler) session() string {
+	if h.PasswordHash != "" {
+		return sessionToken(h.SessionSecret, h.PasswordHash)
+	}
+	return sessionToken(h.SessionSecret, h.Password)
+}
+
+func (h *Handler) validSession(r *http.Request) bool {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(h.session()))
+}
+
+func (h *Handler) HandleSignIn(w http.ResponseWriter, r *http.Request) {
+	var req signInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	if !h.checkPassword(req.Password) {
+		writeError(w, errUnauthorized("Invalid password"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"token": h.session()}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"final_project/repository"
+)
+
+// HandleTaskStatus moves a task to the status in the body {"status": "..."} if the
+// workflow allows it. Moving to done honours ?force= like HandleTaskDone.
+func (h *Handler) HandleTaskStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	force, err := forceParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	if body.Status == "" {
+		writeError(w, errInvalid("status", "The task status is not specified"))
+		return
+	}
+	undo, err := h.Repo.SetTaskStatus(r.Context(), id, version, body.Status, force)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.sendChangedTask(w, http.StatusOK, id, undo)
+}
+
+type boardColumn struct {
+	Status string `json:"status"`
+	// Transitions are the statuses a task in this column may move to.
+	Transitions []string          `json:"transitions"`
+	Tasks       []repository.Task `json:"tasks"`
+	NextCursor  string            `json:"next_cursor,omitempty"`
+}
+
+// HandleBoardGET lists tasks grouped by status, one column per status in workflow order.
+// It takes the filters of HandleTasksGET except status; limit and cursor apply per column,
+// so a column is paged further through /api/tasks?status=.
+func (h *Handler) HandleBoardGET(w http.ResponseWriter, r *http.Request) {
+	query, err := parseTaskQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(query.Statuses) > 0 {
+		writeError(w, errInvalid("status", "The board is always grouped by every status"))
+		return
+	}
+	if query.Cursor != "" {
+		writeError(w, errInvalid("cursor", "Page a single column through /api/tasks?status="))
+		return
+	}
+
+	workflow := h.Repo.Workflow()
+	columns := make([]boardColumn, 0, len(repository.Statuses))
+	for _, status := range repository.Statuses {
+		query.Statuses = []string{status}
+		tasks, next, err := h.Repo.GetTasks(query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		columns = append(columns, boardColumn{
+			Status:      status,
+			Transitions: workflow.Transitions(status),
+			Tasks:       tasks,
+			NextCursor:  next,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"columns": columns}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
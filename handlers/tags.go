@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// HandleTagsGET lists the tags in use with the number of tasks carrying each one.
+func (h *Handler) HandleTagsGET(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.Repo.GetTags()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"tags": tags}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
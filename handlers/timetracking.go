@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"final_project/repository"
+)
+
+func (h *Handler) HandleTimerStart(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entry, err := h.Repo.StartTimer(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sendTimeEntry(w, http.StatusCreated, entry)
+}
+
+func (h *Handler) HandleTimerStop(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entry, err := h.Repo.StopTimer(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sendTimeEntry(w, http.StatusOK, entry)
+}
+
+// HandleTimePOST adds a manual entry {"seconds": ..., "started_at": ..., "note": ...};
+// started_at is optional and defaults to the entry ending now.
+func (h *Handler) HandleTimePOST(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var entry repository.TimeEntry
+	if err = json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		writeError(w, errInvalid("", "Error decoding JSON request: "+err.Error()))
+		return
+	}
+	created, err := h.Repo.AddTimeEntry(id, &entry)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sendTimeEntry(w, http.StatusCreated, created)
+}
+
+// HandleTimeGET lists the time entries of a task with their total.
+func (h *Handler) HandleTimeGET(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entries, total, err := h.Repo.GetTimeEntries(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries, "total_seconds": total}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+// HandleTimeDelete removes the entry named by the {entry} route parameter or ?entry=.
+func (h *Handler) HandleTimeDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entryStr := chi.URLParam(r, "entry")
+	if entryStr == "" {
+		entryStr = r.URL.Query().Get("entry")
+	}
+	entryID, err := strconv.ParseInt(entryStr, 10, 64)
+	if err != nil {
+		writeError(w, errInvalid("entry", "Invalid format of the time entry ID"))
+		return
+	}
+	if err = h.Repo.DeleteTimeEntry(id, entryID); err != nil {
+		writeError(w, err)
+		return
+	}
+	sendEmptyResponse(w)
+}
+
+// HandleTimeReportGET sums up tracked time. Query parameters: from and to (inclusive dates),
+// group (day, week) and task_id.
+func (h *Handler) HandleTimeReportGET(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := repository.TimeReportQuery{Group: params.Get("group")}
+	var err error
+	if value := params.Get("task_id"); value != "" {
+		if query.TaskID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			writeError(w, errInvalid("task_id", "Invalid format of the task ID"))
+			return
+		}
+	}
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if value := params.Get(bound.name); value != "" {
+			*bound.value, err = time.Parse(timeLayout, value)
+			if err != nil {
+				writeError(w, errInvalid(bound.name, "Invalid date format: "+err.Error()))
+				return
+			}
+		}
+	}
+
+	report, err := h.Repo.GetTimeReport(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+func sendTimeEntry(w http.ResponseWriter, status int, entry *repository.TimeEntry) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(entry); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
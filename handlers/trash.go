@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func (h *Handler) HandleTrashGET(w http.ResponseWriter, r *http.Request) {
+	tasks, err := h.Repo.GetTrash(maxTasksLimit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks}); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
+
+func (h *Handler) HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = h.Repo.RestoreTask(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	task, err := h.Repo.GetTask(int(id))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sendTask(w, http.StatusOK, task)
+}
+
+func (h *Handler) HandleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = h.Repo.PurgeTask(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	sendEmptyResponse(w)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// undoHeader carries the token that POST /api/undo accepts, in ?token= or in the same
+// header, to revert the operation. It is a header so that the legacy response bodies
+// stay unchanged.
+const undoHeader = "X-Undo-Token"
+
+func setUndoToken(w http.ResponseWriter, token string) {
+	w.Header().Set(undoHeader, token)
+}
+
+// HandleUndo reverts the operation named by ?token= or the X-Undo-Token header. The token
+// is required, so that a client only undoes the operations it made itself.
+func (h *Handler) HandleUndo(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get(undoHeader)
+	}
+	if token == "" {
+		writeError(w, errInvalid("token", "The undo token is not specified"))
+		return
+	}
+	result, err := h.Repo.Undo(r.Context(), token)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"final_project/repository"
+)
+
+// The v2 API addresses tasks by path (/api/v2/tasks/{id}) and uses status codes
+// instead of success flags. It shares validation with the legacy /api/task handlers.
+
+func (h *Handler) HandleV2TaskPOST(w http.ResponseWriter, r *http.Request) {
+	task, err := decodeNewTask(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, undo, err := h.Repo.InsertTask(r.Context(), task)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v2/tasks/%d", id))
+	h.sendChangedTask(w, http.StatusCreated, id, undo)
+}
+
+func (h *Handler) HandleV2TaskPUT(w http.ResponseWriter, r *http.Request) {
+	task, err := decodeTaskUpdate(r, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	undo, err := h.Repo.UpdateTask(r.Context(), task)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, _ := strconv.ParseInt(task.ID, 10, 64)
+	h.sendChangedTask(w, http.StatusOK, id, undo)
+}
+
+func (h *Handler) HandleV2TaskDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	undo, err := h.Repo.DeleteTask(r.Context(), id, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setUndoToken(w, undo)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleV2TaskDone responds with the rescheduled task for recurring tasks
+// and with 204 when the task was completed and removed.
+func (h *Handler) HandleV2TaskDone(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	force, err := forceParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	undo, err := h.Repo.MarkTaskDone(r.Context(), id, version, force)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setUndoToken(w, undo)
+	task, err := h.Repo.GetTask(int(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sendTask(w, http.StatusOK, task)
+}
+
+func sendTask(w http.ResponseWriter, status int, task *repository.Task) {
+	w.Header().Set("ETag", etag(task.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(task); err != nil {
+		log.Printf("Error writing JSON response: %s", err.Error())
+	}
+}
@@ -1,58 +1,184 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-chi/chi"
-
-	"final_project/handlers"
 	"final_project/repository"
 )
 
+// Defaults of the settings that environment variables and flags override.
+const (
+	defaultPort               = "7540"
+	defaultWebDir             = "./web"
+	defaultDBFile             = "./scheduler.db"
+	defaultBackupDir          = "./backups"
+	defaultTrashRetentionDays = 30
+	defaultUndoRetentionDays  = 7
+	defaultDailyCapacity      = 8 * 60
+	defaultBackupKeep         = 7
+)
+
+// command is a subcommand of the binary; run gets the arguments after its name.
+type command struct {
+	name  string
+	args  string
+	about string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "[-port PORT] [-web DIR]", "run the web server (the default command)", serve},
+	{"migrate", "", "apply the pending schema migrations", migrate},
+	{"backup", "[-dir DIR]", "snapshot the database into the backup directory", backup},
+	{"restore", "[-dir DIR] FILE", "replace the database with a backup; stop the server first", restore},
+	{"import", "[-format json|csv] [-dry-run] FILE", "import tasks from a file, - for stdin", importTasks},
+	{"export", "[-format json|csv] [-o FILE]", "export all tasks to a file or stdout", exportTasks},
+	{"reset-password", "[-clear]", "store the password read from stdin in place of TODO_PASSWORD", resetPassword},
+	{"check", "[-port PORT] [-web DIR]", "check the settings and the database", check},
+}
+
 func main() {
-	port := "7540"
-	webDir := "./web"
-	var repo *repository.Repository
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := os.Stderr
+	fmt.Fprintf(out, "Usage: %s [COMMAND] [-db FILE] [ARGS]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %s\n    \t%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.about)
+	}
+	fmt.Fprint(out, `
+Environment: TODO_DBFILE, TODO_PORT and TODO_WEBDIR set the defaults of -db, -port
+and -web; TODO_PASSWORD, TODO_WORKFLOW, TODO_DAILY_CAPACITY, TODO_TRASH_RETENTION_DAYS,
+TODO_UNDO_RETENTION_DAYS, TODO_BACKUP_DIR, TODO_BACKUP_KEEP and TODO_BACKUP_INTERVAL
+configure the server.
+`)
+}
+
+// newFlagSet returns the flags of a command, starting with -db, which every command has.
+func newFlagSet(name string, dbFile *string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(dbFile, "db", envOr("TODO_DBFILE", defaultDBFile), "database file (TODO_DBFILE)")
+	return flags
+}
+
+// serverFlags adds the -port and -web flags of serve and check.
+func serverFlags(flags *flag.FlagSet, port, webDir *string) {
+	flags.StringVar(port, "port", envOr("TODO_PORT", defaultPort), "port to listen on (TODO_PORT)")
+	flags.StringVar(webDir, "web", envOr("TODO_WEBDIR", defaultWebDir), "directory of the web UI (TODO_WEBDIR)")
+}
+
+func envOr(name, value string) string {
+	if env := os.Getenv(name); env != "" {
+		return env
+	}
+	return value
+}
+
+func checkPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port: %q", port)
+	}
+	return nil
+}
+
+// settings are the server settings read from the environment.
+type settings struct {
+	password       string
+	workflow       *repository.Workflow
+	trashRetention time.Duration
+	undoRetention  time.Duration
+	dailyCapacity  int
+	backupDir      string
+	backupKeep     int
+	backupInterval time.Duration
+}
+
+func loadSettings() (*settings, error) {
+	s := &settings{
+		password:      os.Getenv("TODO_PASSWORD"),
+		dailyCapacity: defaultDailyCapacity,
+		backupDir:     envOr("TODO_BACKUP_DIR", defaultBackupDir),
+	}
 	var err error
-	repo, err = repository.NewRepository("./scheduler.db")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer repo.Close()
-	handler := handlers.Handler{Repo: repo}
-
-	server := chi.NewRouter()
-	server.Mount("/", http.FileServer(http.Dir(webDir)))
-
-	server.Get("/api/nextdate", handlers.HandleNextDate())
-	server.HandleFunc("/api/task", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			handler.HandleTaskGET(w, r)
-		case http.MethodPost:
-			handler.HandleTaskPOST(w, r)
-		case http.MethodPut:
-			handler.HandleTaskPUT(w, r)
-		case http.MethodDelete:
-			handler.HandleTaskDelete(w, r)
-		default:
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if s.trashRetention, err = retentionDays("TODO_TRASH_RETENTION_DAYS", defaultTrashRetentionDays); err != nil {
+		return nil, err
+	}
+	if s.undoRetention, err = retentionDays("TODO_UNDO_RETENTION_DAYS", defaultUndoRetentionDays); err != nil {
+		return nil, err
+	}
+	if env := os.Getenv("TODO_WORKFLOW"); env != "" {
+		workflow, err := repository.ParseWorkflow(env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TODO_WORKFLOW: %w", err)
 		}
-	})
-	server.HandleFunc("/api/task/done", handler.HandleTaskDone)
-	server.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			handler.HandleTasksGET(w, r)
-		} else {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		s.workflow = &workflow
+	}
+	if env := os.Getenv("TODO_DAILY_CAPACITY"); env != "" {
+		var err error
+		s.dailyCapacity, err = strconv.Atoi(env)
+		if err != nil || s.dailyCapacity < 0 {
+			return nil, fmt.Errorf("invalid TODO_DAILY_CAPACITY: %q", env)
 		}
-	})
+	}
+	if s.backupKeep, err = backupKeep(); err != nil {
+		return nil, err
+	}
+	if env := os.Getenv("TODO_BACKUP_INTERVAL"); env != "" {
+		s.backupInterval, err = time.ParseDuration(env)
+		if err != nil || s.backupInterval < 0 {
+			return nil, fmt.Errorf("invalid TODO_BACKUP_INTERVAL: %q", env)
+		}
+	}
+	return s, nil
+}
 
-	fmt.Printf("Server started successfully. Port: %s\n", port)
-	err = http.ListenAndServe(":"+port, server)
-	if err != nil {
-		log.Fatal(err)
+// retentionDays reads a number of days from the environment variable; 0 keeps forever.
+func retentionDays(name string, days int) (time.Duration, error) {
+	if env := os.Getenv(name); env != "" {
+		var err error
+		if days, err = strconv.Atoi(env); err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// backupKeep reads the number of backups to keep (TODO_BACKUP_KEEP, 0 keeps all).
+func backupKeep() (int, error) {
+	env := os.Getenv("TODO_BACKUP_KEEP")
+	if env == "" {
+		return defaultBackupKeep, nil
+	}
+	keep, err := strconv.Atoi(env)
+	if err != nil || keep < 0 {
+		return 0, fmt.Errorf("invalid TODO_BACKUP_KEEP: %q", env)
 	}
+	return keep, nil
 }
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"final_project/taskRepRules"
+)
+
+// Occurrence is a task on one of its dates. A recurring task occurs once per repetition;
+// all its occurrences share the same Task.
+type Occurrence struct {
+	Date string
+	Task *Task
+}
+
+// CalendarDay lists the tasks that occur on one day.
+type CalendarDay struct {
+	Date  string         `json:"date"`
+	Tasks []CalendarTask `json:"tasks"`
+}
+
+// CalendarTask is a task as it occurs on a calendar day. Virtual marks the repetitions
+// beyond the stored date of a recurring task: they exist only until the task is completed.
+type CalendarTask struct {
+	Task
+	Virtual bool `json:"virtual,omitempty"`
+}
+
+// DayLoad is the planned work of one day: the summed estimates in minutes and the number
+// of tasks. A day is overloaded when its estimate exceeds the capacity.
+type DayLoad struct {
+	Date       string `json:"date"`
+	Estimate   int    `json:"estimate"`
+	Tasks      int    `json:"tasks"`
+	Overloaded bool   `json:"overloaded"`
+}
+
+// occurrences expands the live tasks into their dates within [from, to], ordered by date
+// and, within a day, by priority, highest first. Done tasks are skipped unless withDone.
+func (r *Repository) occurrences(from, to time.Time, withDone bool) ([]Occurrence, error) {
+	query := "SELECT id, date, title, comment, repeat, priority, estimate, status, version FROM scheduler WHERE deleted_at IS NULL AND date <= ?"
+	args := []interface{}{to.Format("20060102")}
+	if !withDone {
+		query += " AND status != ?"
+		args = append(args, StatusDone)
+	}
+	rows, err := r.db.Query(query+" ORDER BY priority DESC, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = attachRelated(r.db, tasks); err != nil {
+		return nil, err
+	}
+
+	var result []Occurrence
+	for i := range tasks {
+		dates, err := taskRepRules.Occurrences(tasks[i].Date, tasks[i].Repeat, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("error expanding task %s: %w", tasks[i].ID, err)
+		}
+		for _, date := range dates {
+			result = append(result, Occurrence{Date: date, Task: &tasks[i]})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+	return result, nil
+}
+
+// GetLoad sums up the estimates of the open tasks for every day in [from, to], counting each
+// occurrence of a recurring task. capacity is in minutes; zero disables the overload flag.
+func (r *Repository) GetLoad(from, to time.Time, capacity int) ([]DayLoad, error) {
+	occurrences, err := r.occurrences(from, to, false)
+	if err != nil {
+		return nil, err
+	}
+	days := []DayLoad{}
+	index := map[string]int{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		index[day.Format("20060102")] = len(days)
+		days = append(days, DayLoad{Date: day.Format("20060102")})
+	}
+	for _, o := range occurrences {
+		day := &days[index[o.Date]]
+		day.Estimate += o.Task.Estimate
+		day.Tasks++
+	}
+	for i := range days {
+		days[i].Overloaded = capacity > 0 && days[i].Estimate > capacity
+	}
+	return days, nil
+}
+
+// GetCalendar lists every day in [from, to] with the tasks occurring on it, expanding
+// recurring tasks into one entry per repetition. Completed one-off tasks are included.
+func (r *Repository) GetCalendar(from, to time.Time) ([]CalendarDay, error) {
+	occurrences, err := r.occurrences(from, to, true)
+	if err != nil {
+		return nil, err
+	}
+	days := []CalendarDay{}
+	index := map[string]int{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		index[day.Format("20060102")] = len(days)
+		days = append(days, CalendarDay{Date: day.Format("20060102"), Tasks: []CalendarTask{}})
+	}
+	for _, o := range occurrences {
+		day := &days[index[o.Date]]
+		day.Tasks = append(day.Tasks, CalendarTask{Task: *o.Task, Virtual: o.Date != o.Task.Date})
+	}
+	return days, nil
+}
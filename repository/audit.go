@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Operations that are only recorded in the audit log.
+const (
+	OpRestore = "restore"
+	OpPurge   = "purge"
+	OpUndo    = "undo"
+)
+
+type auditKey string
+
+const (
+	actorKey     auditKey = "actor"
+	requestIDKey auditKey = "requestID"
+)
+
+// WithActor names who performs the writes made with ctx, for the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// WithRequestID ties the writes made with ctx to an HTTP request in the audit log.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func contextString(ctx context.Context, key auditKey, fallback string) string {
+	if value, ok := ctx.Value(key).(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// AuditEntry is one write to a task. Before and After hold only the fields that changed;
+// Before is null for created tasks and After is null for removed ones.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	TaskID    string          `json:"task_id"`
+	Operation string          `json:"operation"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// AuditQuery filters GetAuditLog. Zero values mean no filter; From and To are inclusive.
+type AuditQuery struct {
+	TaskID int64
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// loadSnapshot reads the row including trashed tasks. It returns nil if there is no row.
+func loadSnapshot(tx *sql.Tx, id int64) (*taskSnapshot, error) {
+	var s taskSnapshot
+	err := tx.QueryRow("SELECT id, date, title, comment, repeat, priority, estimate, status, version, deleted_at FROM scheduler WHERE id = ?", id).
+		Scan(&s.ID, &s.Date, &s.Title, &s.Comment, &s.Repeat, &s.Priority, &s.Estimate, &s.Status, &s.Version, &s.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error receiving task data: %w", err)
+	}
+	if err = s.loadRelated(tx); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *taskSnapshot) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"date":       s.Date,
+		"title":      s.Title,
+		"comment":    s.Comment,
+		"repeat":     s.Repeat,
+		"priority":   s.Priority,
+		"estimate":   s.Estimate,
+		"status":     s.Status,
+		"deleted_at": s.DeletedAt,
+		"tags":       s.Tags,
+		"checklist":  s.Checklist,
+		"depends_on": s.DependsOn,
+	}
+}
+
+// diffSnapshots keeps the fields whose values differ. A nil side stays nil.
+func diffSnapshots(before, after *taskSnapshot) (map[string]interface{}, map[string]interface{}) {
+	if before == nil || after == nil {
+		var b, a map[string]interface{}
+		if before != nil {
+			b = before.fields()
+		}
+		if after != nil {
+			a = after.fields()
+		}
+		return b, a
+	}
+	b, a := before.fields(), after.fields()
+	for name := range b {
+		if fmt.Sprint(b[name]) == fmt.Sprint(a[name]) {
+			delete(b, name)
+			delete(a, name)
+		}
+	}
+	return b, a
+}
+
+// recordAudit compares the task with its state before the write and logs the changed fields.
+func recordAudit(ctx context.Context, tx *sql.Tx, op string, taskID int64, before *taskSnapshot) error {
+	after, err := loadSnapshot(tx, taskID)
+	if err != nil {
+		return err
+	}
+	b, a := diffSnapshots(before, after)
+	var beforeJSON, afterJSON interface{}
+	if b != nil {
+		data, _ := json.Marshal(b)
+		beforeJSON = string(data)
+	}
+	if a != nil {
+		data, _ := json.Marshal(a)
+		afterJSON = string(data)
+	}
+	_, err = tx.Exec("INSERT INTO audit_log (task_id, operation, actor, request_id, before, after, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		taskID, op, contextString(ctx, actorKey, "system"), contextString(ctx, requestIDKey, ""),
+		beforeJSON, afterJSON, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the most recent changes first.
+func (r *Repository) GetAuditLog(q AuditQuery) ([]AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	if q.TaskID != 0 {
+		conditions = append(conditions, "task_id = ?")
+		args = append(args, q.TaskID)
+	}
+	if q.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, q.From.UTC().Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, q.To.UTC().Format(time.RFC3339))
+	}
+	query := "SELECT id, task_id, operation, actor, request_id, before, after, created_at FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		err = rows.Scan(&e.ID, &e.TaskID, &e.Operation, &e.Actor, &e.RequestID, &before, &after, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Before, e.After = rawJSON(before), rawJSON(after)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func rawJSON(value sql.NullString) json.RawMessage {
+	if !value.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(value.String)
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup files are named backupPrefix + timestamp + backupSuffix, so that they sort by age.
+const (
+	backupPrefix = "scheduler-"
+	backupSuffix = ".db"
+	backupLayout = "20060102-150405.000"
+)
+
+// Backup writes a snapshot of the database to a new timestamped file in dir and returns
+// its path. The SQLite online backup API gives a consistent copy while the server keeps
+// writing.
+func (r *Repository) Backup(ctx context.Context, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating the backup directory: %w", err)
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().Format(backupLayout)+backupSuffix)
+	if err := copyDatabase(ctx, r.db, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// PruneBackups deletes all but the keep newest backups in dir and returns the deleted paths.
+// A keep of zero or less keeps every backup.
+func PruneBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil || len(backups) <= keep {
+		return nil, err
+	}
+	removed := backups[:len(backups)-keep]
+	for _, path := range removed {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error deleting an old backup: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// ListBackups returns the paths of the backups in dir, oldest first.
+func ListBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the backup directory: %w", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// CheckDatabase verifies, without changing it, that a database file or backup is usable:
+// it must pass the integrity check and have a schema version this build knows. It returns
+// the schema version; an older one is migrated when the database is opened.
+func CheckDatabase(ctx context.Context, path string) (int, error) {
+	src, err := openReadOnly(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	return checkDatabase(ctx, src)
+}
+
+// Restore replaces the database at dbPath with a backup that passes CheckDatabase.
+// The server must not be running meanwhile.
+func Restore(ctx context.Context, dbPath, backupPath string) error {
+	src, err := openReadOnly(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err = checkDatabase(ctx, src); err != nil {
+		return err
+	}
+
+	// The copy is made next to the database and renamed over it, so that a failure
+	// leaves the database as it was.
+	tmp := dbPath + ".restore"
+	os.Remove(tmp)
+	if err = copyDatabase(ctx, src, tmp); err != nil {
+		return err
+	}
+	os.Remove(dbPath + "-journal")
+	if err = os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing the database: %w", err)
+	}
+	return nil
+}
+
+func openReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error opening the database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dataSource(path, url.Values{"mode": {"ro"}}))
+	if err != nil {
+		return nil, fmt.Errorf("error opening the database: %w", err)
+	}
+	return db, nil
+}
+
+func checkDatabase(ctx context.Context, db *sql.DB) (int, error) {
+	var check string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&check); err != nil {
+		return 0, fmt.Errorf("error checking the database: %w", err)
+	}
+	if check != "ok" {
+		return 0, fmt.Errorf("the database is damaged: %s", check)
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	if version < 1 || version > len(migrations) {
+		return version, fmt.Errorf("the database has schema version %d, this build supports 1 to %d", version, len(migrations))
+	}
+	return version, nil
+}
+
+// copyDatabase copies the main database of src into a new file at path with the online
+// backup API. A partial file is removed on failure.
+func copyDatabase(ctx context.Context, src *sql.DB, path string) (err error) {
+	if _, err = os.Stat(path); err == nil {
+		return fmt.Errorf("the file %s already exists", path)
+	}
+	dest, err := sql.Open("sqlite3", dataSource(path, nil))
+	if err != nil {
+		return fmt.Errorf("error creating the backup: %w", err)
+	}
+	defer func() {
+		dest.Close()
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating the backup: %w", err)
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("error starting the backup: %w", err)
+			}
+			if _, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("error copying the database: %w", err)
+			}
+			if err = backup.Finish(); err != nil {
+				return fmt.Errorf("error finishing the backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
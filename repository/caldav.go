@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CalDAVObject is a task as a CalDAV resource. Tasks created by CalDAV clients keep the
+// resource name and UID that the client chose; other tasks are named "<id>.ics" and have
+// no UID of their own.
+type CalDAVObject struct {
+	Name string
+	UID  string
+	Task *Task
+}
+
+// CalDAVObjects returns every live task as a CalDAV resource.
+func (r *Repository) CalDAVObjects() ([]CalDAVObject, error) {
+	names, err := r.caldavNames()
+	if err != nil {
+		return nil, err
+	}
+	objects := []CalDAVObject{}
+	err = r.EachTask(TaskQuery{}, func(task *Task) error {
+		object := names[task.ID]
+		if object.Name == "" {
+			object.Name = task.ID + ".ics"
+		}
+		object.Task = task
+		objects = append(objects, object)
+		return nil
+	})
+	return objects, err
+}
+
+func (r *Repository) caldavNames() (map[string]CalDAVObject, error) {
+	rows, err := r.db.Query("SELECT task_id, name, uid FROM caldav_objects")
+	if err != nil {
+		return nil, fmt.Errorf("error receiving CalDAV objects: %w", err)
+	}
+	defer rows.Close()
+
+	names := map[string]CalDAVObject{}
+	for rows.Next() {
+		var taskID int64
+		var object CalDAVObject
+		if err = rows.Scan(&taskID, &object.Name, &object.UID); err != nil {
+			return nil, err
+		}
+		names[fmt.Sprintf("%d", taskID)] = object
+	}
+	return names, rows.Err()
+}
+
+// CalDAVObject finds the live task behind a resource name. A task named by a client
+// cannot be reached as "<id>.ics", so every task has a single name.
+func (r *Repository) CalDAVObject(name string) (*CalDAVObject, error) {
+	object := CalDAVObject{Name: name}
+	var taskID int64
+	err := r.db.QueryRow("SELECT task_id, uid FROM caldav_objects WHERE name = ?", name).Scan(&taskID, &object.UID)
+	if err == sql.ErrNoRows {
+		id, ok := strings.CutSuffix(name, ".ics")
+		if !ok {
+			return nil, ErrTaskNotFound
+		}
+		if taskID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, ErrTaskNotFound
+		}
+		var named bool
+		err = r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM caldav_objects WHERE task_id = ?)", taskID).Scan(&named)
+		if err == nil && named {
+			return nil, ErrTaskNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error receiving the CalDAV object: %w", err)
+	}
+	if object.Task, err = r.GetTask(int(taskID)); err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// InsertCalDAVTask adds a task that a client created under the resource name and UID it
+// chose, with a single journal entry. A completed to-do is completed right away like with
+// SetTaskStatus, which moves a recurring task to its next date. On success task.Version
+// holds the version of the new task.
+func (r *Repository) InsertCalDAVTask(ctx context.Context, task *Task, name, uid string, completed bool) (int64, error) {
+	var id int64
+	err := r.withTx(func(tx *sql.Tx) error {
+		if task.Status == "" {
+			task.Status = StatusTodo
+		}
+		if err := r.workflow.checkEdit(StatusTodo, task.Status); err != nil {
+			return err
+		}
+		var err error
+		if id, err = insertTask(tx, task); err != nil {
+			return err
+		}
+		// The name of a task that was purged is reused.
+		_, err = tx.Exec("INSERT OR REPLACE INTO caldav_objects (name, task_id, uid) VALUES (?, ?, ?)", name, id, uid)
+		if err != nil {
+			return fmt.Errorf("error naming the CalDAV object: %w", err)
+		}
+		if completed {
+			if err = r.workflow.check(task.Status, StatusDone); err != nil {
+				return err
+			}
+			before, err := loadForWrite(tx, id, 0)
+			if err != nil {
+				return err
+			}
+			if err = complete(tx, before, false, true); err != nil {
+				return err
+			}
+		}
+		if err = tx.QueryRow("SELECT version FROM scheduler WHERE id = ?", id).Scan(&task.Version); err != nil {
+			return fmt.Errorf("error receiving task data: %w", err)
+		}
+		_, err = journal(ctx, tx, OpInsert, id, nil)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateCalDAVTask applies the patch and, if completed is set, completes the task in the
+// same transaction, so that a refused completion leaves the task untouched. On success
+// it returns the new version.
+func (r *Repository) UpdateCalDAVTask(ctx context.Context, id int64, patch *TaskPatch, completed bool) (int64, error) {
+	op := OpUpdate
+	if completed {
+		op = OpDone
+	}
+	var version int64
+	_, err := r.mutate(ctx, op, id, patch.Version, func(tx *sql.Tx, before *taskSnapshot) error {
+		if err := r.patchTx(tx, before, patch); err != nil {
+			return err
+		}
+		if completed {
+			patched, err := loadForWrite(tx, id, 0)
+			if err != nil {
+				return err
+			}
+			if err = r.workflow.check(patched.Status, StatusDone); err != nil {
+				return err
+			}
+			if err = complete(tx, patched, false, true); err != nil {
+				return err
+			}
+		}
+		if err := tx.QueryRow("SELECT version FROM scheduler WHERE id = ?", id).Scan(&version); err != nil {
+			return fmt.Errorf("error receiving task data: %w", err)
+		}
+		return nil
+	})
+	return version, err
+}
+
+// CalDAVCTag changes whenever a task is added, changed or deleted, so that clients
+// can tell without listing the tasks whether the calendar needs a sync.
+func (r *Repository) CalDAVCTag() (string, error) {
+	var count, versions, maxID int64
+	err := r.db.QueryRow("SELECT count(*), coalesce(sum(version), 0), coalesce(max(id), 0) FROM scheduler WHERE deleted_at IS NULL").
+		Scan(&count, &versions, &maxID)
+	if err != nil {
+		return "", fmt.Errorf("error receiving task data: %w", err)
+	}
+	return fmt.Sprintf("%d-%d-%d", count, versions, maxID), nil
+}
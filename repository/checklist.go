@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ChecklistItem is a step of a task with its own done state. Checklists are
+// returned with a single task (GetTask) but not in task lists.
+type ChecklistItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// ChecklistPatch lists the item fields to change. Nil fields are left unchanged.
+type ChecklistPatch struct {
+	Title *string
+	Done  *bool
+}
+
+func loadChecklist(q queryer, taskID int64) ([]ChecklistItem, error) {
+	rows, err := q.Query("SELECT id, title, done FROM checklist_items WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving the checklist: %w", err)
+	}
+	defer rows.Close()
+
+	var items []ChecklistItem
+	for rows.Next() {
+		var item ChecklistItem
+		var id int64
+		if err = rows.Scan(&id, &item.Title, &item.Done); err != nil {
+			return nil, err
+		}
+		item.ID = fmt.Sprintf("%d", id)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// setChecklist replaces the checklist of a task. Items with an ID are updated in place, or
+// recreated if they were deleted, which is how undo puts a checklist back as it was; items
+// without one are added.
+func setChecklist(tx *sql.Tx, taskID int64, items []ChecklistItem) error {
+	keep := []interface{}{taskID}
+	for _, item := range items {
+		if item.ID != "" {
+			keep = append(keep, item.ID)
+		}
+	}
+	query := "DELETE FROM checklist_items WHERE task_id = ?"
+	if len(keep) > 1 {
+		query += " AND id NOT IN (?" + strings.Repeat(", ?", len(keep)-2) + ")"
+	}
+	if _, err := tx.Exec(query, keep...); err != nil {
+		return fmt.Errorf("error updating the checklist: %w", err)
+	}
+	for _, item := range items {
+		var id interface{}
+		if item.ID != "" {
+			id = item.ID
+		}
+		_, err := tx.Exec(`INSERT INTO checklist_items (id, task_id, title, done) VALUES (?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET title = excluded.title, done = excluded.done WHERE task_id = excluded.task_id`,
+			id, taskID, item.Title, item.Done)
+		if err != nil {
+			return fmt.Errorf("error updating the checklist: %w", err)
+		}
+	}
+	return nil
+}
+
+// newChecklist validates checklist items given by a client. Items keep their IDs if they
+// are in current, the checklist of the task, so that clients can go on using them; other
+// IDs are dropped and the items are added as new ones.
+func newChecklist(items, current []ChecklistItem) ([]ChecklistItem, error) {
+	known := make(map[string]bool, len(current))
+	for _, item := range current {
+		known[item.ID] = true
+	}
+	result := make([]ChecklistItem, 0, len(items))
+	for _, item := range items {
+		if item.Title == "" {
+			return nil, NewValidationError("checklist", "The checklist item title is not specified")
+		}
+		// An ID sent twice only stays with its first item.
+		if known[item.ID] {
+			delete(known, item.ID)
+		} else {
+			item.ID = ""
+		}
+		result = append(result, ChecklistItem{ID: item.ID, Title: item.Title, Done: item.Done})
+	}
+	return result, nil
+}
+
+// AddChecklistItem appends an item to the checklist of a live task.
+// A non-zero version must match the stored task version.
+func (r *Repository) AddChecklistItem(ctx context.Context, taskID int64, version int64, title string) (string, error) {
+	if title == "" {
+		return "", NewValidationError("title", "The checklist item title is not specified")
+	}
+	return r.mutate(ctx, OpUpdate, taskID, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		_, err := tx.Exec("INSERT INTO checklist_items (task_id, title, done) VALUES (?, ?, 0)", taskID, title)
+		if err != nil {
+			return fmt.Errorf("error adding a checklist item: %w", err)
+		}
+		return touchTask(tx, taskID)
+	})
+}
+
+// UpdateChecklistItem renames an item or changes its done state.
+func (r *Repository) UpdateChecklistItem(ctx context.Context, taskID, itemID int64, version int64, patch *ChecklistPatch) (string, error) {
+	if patch.Title != nil && *patch.Title == "" {
+		return "", NewValidationError("title", "The checklist item title is not specified")
+	}
+	return r.mutate(ctx, OpUpdate, taskID, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		res, err := tx.Exec("UPDATE checklist_items SET title = coalesce(?, title), done = coalesce(?, done) WHERE id = ? AND task_id = ?",
+			patch.Title, patch.Done, itemID, taskID)
+		if err != nil {
+			return fmt.Errorf("error updating a checklist item: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrChecklistItemNotFound
+		}
+		return touchTask(tx, taskID)
+	})
+}
+
+// DeleteChecklistItem removes an item from the checklist.
+func (r *Repository) DeleteChecklistItem(ctx context.Context, taskID, itemID int64, version int64) (string, error) {
+	return r.mutate(ctx, OpUpdate, taskID, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		res, err := tx.Exec("DELETE FROM checklist_items WHERE id = ? AND task_id = ?", itemID, taskID)
+		if err != nil {
+			return fmt.Errorf("error deleting a checklist item: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrChecklistItemNotFound
+		}
+		return touchTask(tx, taskID)
+	})
+}
+
+// touchTask bumps the task version after a change to data that belongs to the task.
+func touchTask(tx *sql.Tx, taskID int64) error {
+	if _, err := tx.Exec("UPDATE scheduler SET version = version + 1 WHERE id = ?", taskID); err != nil {
+		return fmt.Errorf("task update error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Completion is a record of a task being marked done. The title is copied
+// because one-off tasks are deleted when completed.
+type Completion struct {
+	ID            string `json:"id"`
+	TaskID        string `json:"task_id"`
+	Title         string `json:"title"`
+	ScheduledDate string `json:"scheduled_date"`
+	CompletedAt   string `json:"completed_at"`
+	// TrackedSeconds is the time tracked on the task since its previous completion.
+	TrackedSeconds int64 `json:"tracked_seconds,omitempty"`
+}
+
+// insertCompletion stops a running timer of the task and records the completion
+// with the time recorded since the previous one. Entries are told apart by ID rather
+// than by start, so that a backdated manual entry still counts once.
+func insertCompletion(tx *sql.Tx, task *Task) error {
+	id, err := strconv.ParseInt(task.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid task ID %q: %w", task.ID, err)
+	}
+	now := time.Now().UTC()
+	if _, err = stopTimer(tx, id, now); err != nil {
+		return err
+	}
+	var counted int64
+	err = tx.QueryRow("SELECT coalesce(max(last_time_entry_id), 0) FROM completions WHERE task_id = ?", id).Scan(&counted)
+	if err != nil {
+		return fmt.Errorf("error receiving completions: %w", err)
+	}
+	tracked, last, err := trackedAfter(tx, id, counted)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO completions (task_id, title, scheduled_date, completed_at, tracked_seconds, last_time_entry_id) VALUES (?, ?, ?, ?, ?, ?)",
+		id, task.Title, task.Date, now.Format(time.RFC3339), tracked, last)
+	if err != nil {
+		return fmt.Errorf("error recording completion: %w", err)
+	}
+	return nil
+}
+
+// GetCompletions returns the most recent completions first. A zero taskID selects all tasks.
+func (r *Repository) GetCompletions(taskID int64, limit int) ([]Completion, error) {
+	query := "SELECT id, task_id, title, scheduled_date, completed_at, tracked_seconds FROM completions"
+	var args []interface{}
+	if taskID != 0 {
+		query += " WHERE task_id = ?"
+		args = append(args, taskID)
+	}
+	query += " ORDER BY completed_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completions := []Completion{}
+	for rows.Next() {
+		var c Completion
+		if err = rows.Scan(&c.ID, &c.TaskID, &c.Title, &c.ScheduledDate, &c.CompletedAt, &c.TrackedSeconds); err != nil {
+			return nil, err
+		}
+		completions = append(completions, c)
+	}
+	return completions, rows.Err()
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A prerequisite is open while it is a live task that is not done. A recurring prerequisite
+// never stays done, so it counts as done once it has been completed after the dependency was added.
+const dependencyQuery = `SELECT d.task_id, d.depends_on,
+		s.status = 'done' OR (s.repeat <> '' AND EXISTS (SELECT 1 FROM completions c WHERE c.task_id = d.depends_on AND c.completed_at >= d.created_at))
+	FROM task_dependencies d JOIN scheduler s ON s.id = d.depends_on AND s.deleted_at IS NULL
+	WHERE d.task_id IN (%s) ORDER BY d.depends_on`
+
+type dependencies struct {
+	dependsOn []string
+	blockers  []string
+}
+
+// loadDependencies returns the live prerequisites of the given tasks and the open ones among them.
+func loadDependencies(q queryer, ids []int64) (map[int64]*dependencies, error) {
+	deps := make(map[int64]*dependencies)
+	if len(ids) == 0 {
+		return deps, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query(fmt.Sprintf(dependencyQuery, placeholders(len(ids))), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving task dependencies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, dependsOn int64
+		var done bool
+		if err = rows.Scan(&id, &dependsOn, &done); err != nil {
+			return nil, err
+		}
+		d := deps[id]
+		if d == nil {
+			d = &dependencies{}
+			deps[id] = d
+		}
+		d.dependsOn = append(d.dependsOn, strconv.FormatInt(dependsOn, 10))
+		if !done {
+			d.blockers = append(d.blockers, strconv.FormatInt(dependsOn, 10))
+		}
+	}
+	return deps, rows.Err()
+}
+
+// parseDependencies checks that the prerequisites are valid task IDs and drops duplicates.
+func parseDependencies(dependsOn []string) ([]int64, error) {
+	seen := make(map[int64]bool, len(dependsOn))
+	var ids []int64
+	for _, value := range dependsOn {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, NewValidationError("depends_on", "Invalid format of the task ID: "+value)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// setDependencies replaces the prerequisites of a task. Prerequisites must be live tasks
+// and must not depend on the task, directly or through other tasks.
+func setDependencies(tx *sql.Tx, taskID int64, dependsOn []string) error {
+	ids, err := parseDependencies(dependsOn)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == taskID {
+			return NewValidationError("depends_on", "A task cannot depend on itself")
+		}
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM scheduler WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error receiving task data: %w", err)
+		}
+		if !exists {
+			return NewValidationError("depends_on", fmt.Sprintf("Task %d not found", id))
+		}
+		cycle, err := reaches(tx, id, taskID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return NewValidationError("depends_on", fmt.Sprintf("Task %d already depends on this task", id))
+		}
+	}
+	return writeDependencies(tx, taskID, ids)
+}
+
+// writeDependencies stores the prerequisites without checks. Dependencies that stay
+// keep their creation time, which decides whether recurring prerequisites are done.
+func writeDependencies(tx *sql.Tx, taskID int64, ids []int64) error {
+	keep := make([]interface{}, 0, len(ids)+1)
+	keep = append(keep, taskID)
+	for _, id := range ids {
+		keep = append(keep, id)
+	}
+	query := "DELETE FROM task_dependencies WHERE task_id = ?"
+	if len(ids) > 0 {
+		query += " AND depends_on NOT IN (" + placeholders(len(ids)) + ")"
+	}
+	if _, err := tx.Exec(query, keep...); err != nil {
+		return fmt.Errorf("error updating task dependencies: %w", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, id := range ids {
+		_, err := tx.Exec("INSERT OR IGNORE INTO task_dependencies (task_id, depends_on, created_at) VALUES (?, ?, ?)", taskID, id, now)
+		if err != nil {
+			return fmt.Errorf("error updating task dependencies: %w", err)
+		}
+	}
+	return nil
+}
+
+// reaches tells whether task from depends on task to, directly or transitively.
+func reaches(tx *sql.Tx, from, to int64) (bool, error) {
+	var found bool
+	err := tx.QueryRow(`WITH RECURSIVE reach(id) AS (
+			SELECT ?
+			UNION
+			SELECT d.depends_on FROM task_dependencies d JOIN reach ON d.task_id = reach.id
+		)
+		SELECT EXISTS (SELECT 1 FROM reach WHERE id = ?)`, from, to).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("error checking task dependencies: %w", err)
+	}
+	return found, nil
+}
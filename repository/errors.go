@@ -0,0 +1,40 @@
+package repository
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	// ErrVersionMismatch means the task changed since the client last read it.
+	ErrVersionMismatch = errors.New("task was modified by someone else")
+
+	ErrTaskNotFound  = &notFoundError{entity: "task"}
+	ErrTokenNotFound = &notFoundError{entity: "token"}
+	ErrUndoNotFound  = &notFoundError{entity: "undo entry"}
+
+	ErrChecklistItemNotFound = &notFoundError{entity: "checklist item"}
+	ErrTimeEntryNotFound     = &notFoundError{entity: "time entry"}
+)
+
+type notFoundError struct {
+	entity string
+}
+
+func (e *notFoundError) Error() string { return e.entity + " not found" }
+
+func (e *notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// ValidationError describes invalid input. Field names the offending JSON field, if any.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Field: field, Message: message}
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
+func (e *ValidationError) Is(target error) bool { return target == ErrValidation }
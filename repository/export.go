@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExportTasks calls fn for every live task in the order of creation, with its checklist.
+func (r *Repository) ExportTasks(fn func(*Task) error) error {
+	return r.EachTask(TaskQuery{Sort: SortCreated}, func(task *Task) error {
+		id, _ := strconv.ParseInt(task.ID, 10, 64)
+		var err error
+		if task.Checklist, err = loadChecklist(r.db, id); err != nil {
+			return err
+		}
+		return fn(task)
+	})
+}
+
+// EachCompletion calls fn for every completion, oldest first. Like EachTask it reads
+// page by page, so that no query stays open while fn writes a response.
+func (r *Repository) EachCompletion(fn func(*Completion) error) error {
+	const pageSize = 500
+	var after int64
+	for {
+		rows, err := r.db.Query("SELECT id, task_id, title, scheduled_date, completed_at, tracked_seconds FROM completions WHERE id > ? ORDER BY id LIMIT ?",
+			after, pageSize)
+		if err != nil {
+			return fmt.Errorf("error receiving completions: %w", err)
+		}
+		var page []Completion
+		for rows.Next() {
+			var c Completion
+			if err = rows.Scan(&c.ID, &c.TaskID, &c.Title, &c.ScheduledDate, &c.CompletedAt, &c.TrackedSeconds); err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, c)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for i := range page {
+			if err = fn(&page[i]); err != nil {
+				return err
+			}
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		after, _ = strconv.ParseInt(page[len(page)-1].ID, 10, 64)
+	}
+}
+
+// TaskImport adds the tasks of an import in one transaction. Every task is written under
+// a savepoint, so that a task that fails leaves the others in.
+type TaskImport struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// Import runs fn with a TaskImport and commits the tasks it added. A dry run rolls them
+// back instead, so it makes every check of a real import.
+func (r *Repository) Import(ctx context.Context, dryRun bool, fn func(*TaskImport) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if err = fn(&TaskImport{ctx: ctx, tx: tx}); err != nil || dryRun {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// InsertTask adds the task and returns its ID. Unlike Repository.InsertTask it takes any
+// status, done included, because the task is restored as it was exported rather than
+// moved through the workflow.
+func (imp *TaskImport) InsertTask(task *Task) (int64, error) {
+	if task.Status == "" {
+		task.Status = StatusTodo
+	}
+	if !validStatus(task.Status) {
+		return 0, NewValidationError("status", "The status must be one of: "+strings.Join(Statuses, ", "))
+	}
+	var id int64
+	err := imp.savepoint(func() error {
+		var err error
+		if id, err = insertTask(imp.tx, task); err != nil {
+			return err
+		}
+		_, err = journal(imp.ctx, imp.tx, OpInsert, id, nil)
+		return err
+	})
+	return id, err
+}
+
+// SetDependencies replaces the prerequisites of a task added by the import.
+func (imp *TaskImport) SetDependencies(id int64, dependsOn []string) error {
+	return imp.savepoint(func() error {
+		_, err := mutateTx(imp.ctx, imp.tx, OpUpdate, id, 0, func(tx *sql.Tx, before *taskSnapshot) error {
+			if _, err := tx.Exec("UPDATE scheduler SET version = version + 1 WHERE id = ?", id); err != nil {
+				return fmt.Errorf("task update error: %w", err)
+			}
+			return setDependencies(tx, id, dependsOn)
+		})
+		return err
+	})
+}
+
+// FindDuplicate returns the ID of a live task with the same title and repeat rule on
+// one of the dates, or "" if there is none.
+func (imp *TaskImport) FindDuplicate(title, repeat string, dates ...string) (string, error) {
+	args := []interface{}{title, repeat}
+	for _, date := range dates {
+		args = append(args, date)
+	}
+	var id int64
+	err := imp.tx.QueryRow(fmt.Sprintf("SELECT coalesce(min(id), 0) FROM scheduler WHERE title = ? AND repeat = ? AND date IN (%s) AND deleted_at IS NULL",
+		placeholders(len(dates))), args...).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("error receiving task data: %w", err)
+	}
+	if id == 0 {
+		return "", nil
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// savepoint runs fn so that its writes are undone if it fails.
+func (imp *TaskImport) savepoint(fn func() error) error {
+	if _, err := imp.tx.Exec("SAVEPOINT task_import"); err != nil {
+		return fmt.Errorf("error starting a savepoint: %w", err)
+	}
+	if err := fn(); err != nil {
+		imp.tx.Exec("ROLLBACK TO task_import")
+		imp.tx.Exec("RELEASE task_import")
+		return err
+	}
+	if _, err := imp.tx.Exec("RELEASE task_import"); err != nil {
+		return fmt.Errorf("error releasing a savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Operations recorded in the undo journal.
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDone   = "done"
+	OpDelete = "delete"
+)
+
+// taskSnapshot is the full scheduler row as it was before a write.
+type taskSnapshot struct {
+	ID        int64           `json:"id"`
+	Date      string          `json:"date"`
+	Title     string          `json:"title"`
+	Comment   string          `json:"comment"`
+	Repeat    string          `json:"repeat"`
+	Priority  int             `json:"priority"`
+	Estimate  int             `json:"estimate"`
+	Status    string          `json:"status"`
+	Version   int64           `json:"version"`
+	DeletedAt *string         `json:"deleted_at"`
+	Tags      []string        `json:"tags"`
+	Checklist []ChecklistItem `json:"checklist"`
+	DependsOn []string        `json:"depends_on"`
+}
+
+func (s *taskSnapshot) task() *Task {
+	return &Task{
+		ID:        fmt.Sprintf("%d", s.ID),
+		Date:      s.Date,
+		Title:     s.Title,
+		Comment:   s.Comment,
+		Repeat:    s.Repeat,
+		Priority:  s.Priority,
+		Estimate:  s.Estimate,
+		Status:    s.Status,
+		Version:   s.Version,
+		Tags:      s.Tags,
+		Checklist: s.Checklist,
+		DependsOn: s.DependsOn,
+	}
+}
+
+// loadForWrite reads a live task inside a write transaction and checks the expected version.
+func loadForWrite(tx *sql.Tx, id interface{}, version int64) (*taskSnapshot, error) {
+	var s taskSnapshot
+	err := tx.QueryRow("SELECT id, date, title, comment, repeat, priority, estimate, status, version, deleted_at FROM scheduler WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&s.ID, &s.Date, &s.Title, &s.Comment, &s.Repeat, &s.Priority, &s.Estimate, &s.Status, &s.Version, &s.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error receiving task data: %w", err)
+	}
+	if version != 0 && version != s.Version {
+		return nil, ErrVersionMismatch
+	}
+	if err = s.loadRelated(tx); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// recordUndo journals the state of the task before an operation and returns the undo token.
+// before is nil for inserts, where undoing means removing the task again. The version after
+// the operation, 0 if the task is gone, is kept to tell later whether the task is unchanged.
+func recordUndo(tx *sql.Tx, op string, taskID int64, before *taskSnapshot) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating undo token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	var snapshot interface{}
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return "", fmt.Errorf("error encoding undo snapshot: %w", err)
+		}
+		snapshot = string(data)
+	}
+	var after int64
+	err := tx.QueryRow("SELECT version FROM scheduler WHERE id = ?", taskID).Scan(&after)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error receiving task data: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO undo_journal (token, operation, task_id, before, created_at, after_version) VALUES (?, ?, ?, ?, ?, ?)",
+		token, op, taskID, snapshot, time.Now().UTC().Format(time.RFC3339), after)
+	if err != nil {
+		return "", fmt.Errorf("error writing undo journal: %w", err)
+	}
+	return token, nil
+}
+
+// UndoResult describes a reverted operation. Task is nil when an insert was undone.
+type UndoResult struct {
+	Operation string `json:"operation"`
+	TaskID    string `json:"task_id"`
+	Task      *Task  `json:"task,omitempty"`
+}
+
+// Undo reverts the operation with the given token. An operation can only be undone if it
+// is the last one on its task and the task has not changed or been purged since.
+func (r *Repository) Undo(ctx context.Context, token string) (*UndoResult, error) {
+	var result UndoResult
+	err := r.withTx(func(tx *sql.Tx) error {
+		var entryID, taskID int64
+		var op string
+		var before, undoneAt sql.NullString
+		var after sql.NullInt64
+		err := tx.QueryRow("SELECT id, operation, task_id, before, undone_at, after_version FROM undo_journal WHERE token = ?", token).
+			Scan(&entryID, &op, &taskID, &before, &undoneAt, &after)
+		if err == sql.ErrNoRows {
+			return ErrUndoNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error reading undo journal: %w", err)
+		}
+		if undoneAt.Valid {
+			return fmt.Errorf("%w: the operation has already been undone", ErrConflict)
+		}
+
+		var later int
+		err = tx.QueryRow("SELECT count(*) FROM undo_journal WHERE task_id = ? AND id > ? AND undone_at IS NULL", taskID, entryID).Scan(&later)
+		if err != nil {
+			return fmt.Errorf("error reading undo journal: %w", err)
+		}
+		if later > 0 {
+			return fmt.Errorf("%w: the task has been changed since, undo the later changes first", ErrConflict)
+		}
+
+		current, err := loadSnapshot(tx, taskID)
+		if err != nil {
+			return err
+		}
+		// Entries journaled before the version was kept are not checked.
+		if after.Valid {
+			switch {
+			case current == nil && after.Int64 != 0:
+				return fmt.Errorf("%w: the task has been purged since", ErrConflict)
+			case current != nil && current.Version != after.Int64:
+				return fmt.Errorf("%w: the task has been changed since", ErrConflict)
+			}
+		}
+		if !before.Valid {
+			if err = deleteTaskRow(tx, taskID); err != nil {
+				return err
+			}
+		} else {
+			var s taskSnapshot
+			if err = json.Unmarshal([]byte(before.String), &s); err != nil {
+				return fmt.Errorf("error decoding undo snapshot: %w", err)
+			}
+			restored := s.Version
+			if err = restoreSnapshot(tx, &s); err != nil {
+				return err
+			}
+			// The task is back in the state the previous operation left, under a new version.
+			_, err = tx.Exec("UPDATE undo_journal SET after_version = ? WHERE task_id = ? AND id < ? AND undone_at IS NULL AND after_version = ?",
+				s.Version, taskID, entryID, restored)
+			if err != nil {
+				return fmt.Errorf("error updating undo journal: %w", err)
+			}
+			if op == OpDone {
+				_, err = tx.Exec("DELETE FROM completions WHERE id = (SELECT MAX(id) FROM completions WHERE task_id = ?)", taskID)
+				if err != nil {
+					return fmt.Errorf("error removing completion: %w", err)
+				}
+			}
+			if s.DeletedAt == nil {
+				result.Task = s.task()
+			}
+		}
+
+		_, err = tx.Exec("UPDATE undo_journal SET undone_at = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), entryID)
+		if err != nil {
+			return fmt.Errorf("error updating undo journal: %w", err)
+		}
+		if err = recordAudit(ctx, tx, OpUndo, taskID, current); err != nil {
+			return err
+		}
+		result.Operation = op
+		result.TaskID = fmt.Sprintf("%d", taskID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PruneUndoJournal deletes the undo entries recorded before the given time.
+func (r *Repository) PruneUndoJournal(before time.Time) (int64, error) {
+	res, err := r.db.Exec("DELETE FROM undo_journal WHERE created_at < ?", before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("error pruning undo journal: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// restoreSnapshot writes the row back, recreating it if it was deleted. The version keeps
+// growing so that ETags handed out after the undone operation do not match again.
+func restoreSnapshot(tx *sql.Tx, s *taskSnapshot) error {
+	var current int64
+	err := tx.QueryRow("SELECT version FROM scheduler WHERE id = ?", s.ID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error receiving task data: %w", err)
+	}
+	if current < s.Version {
+		current = s.Version
+	}
+	s.Version = current + 1
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO scheduler (id, date, title, comment, repeat, priority, estimate, status, version, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		s.ID, s.Date, s.Title, s.Comment, s.Repeat, s.Priority, s.Estimate, s.Status, s.Version, s.DeletedAt)
+	if err != nil {
+		return fmt.Errorf("error restoring the task: %w", err)
+	}
+	if err = setTaskTags(tx, s.ID, s.Tags); err != nil {
+		return err
+	}
+	if err = setChecklist(tx, s.ID, s.Checklist); err != nil {
+		return err
+	}
+	ids, err := parseDependencies(s.DependsOn)
+	if err != nil {
+		return err
+	}
+	// Other tasks may have come to depend on this one since the snapshot.
+	for _, id := range ids {
+		cycle, err := reaches(tx, id, s.ID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("%w: task %d now depends on this task, restoring the dependency would create a cycle", ErrConflict, id)
+		}
+	}
+	return writeDependencies(tx, s.ID, ids)
+}
+
+// loadRelated reads the rows that belong to the task: its tags, checklist and prerequisites.
+func (s *taskSnapshot) loadRelated(tx *sql.Tx) error {
+	tags, err := loadTags(tx, []int64{s.ID})
+	if err != nil {
+		return err
+	}
+	s.Tags = tags[s.ID]
+	if s.Checklist, err = loadChecklist(tx, s.ID); err != nil {
+		return err
+	}
+	deps, err := loadDependencies(tx, []int64{s.ID})
+	if err != nil {
+		return err
+	}
+	if d := deps[s.ID]; d != nil {
+		s.DependsOn = d.dependsOn
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import "fmt"
+
+// migrations are applied in order; PRAGMA user_version stores how many of them
+// the database file has already seen. Never edit an entry once released, append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS scheduler (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TEXT,
+		title TEXT,
+		comment TEXT,
+		repeat TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_date ON scheduler(date);`,
+
+	`CREATE TABLE api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		last_used_at TEXT
+	);`,
+
+	`ALTER TABLE scheduler ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+
+	`CREATE TABLE completions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		scheduled_date TEXT NOT NULL,
+		completed_at TEXT NOT NULL
+	);
+	CREATE INDEX idx_completions_task ON completions(task_id, completed_at);`,
+
+	`ALTER TABLE scheduler ADD COLUMN deleted_at TEXT;`,
+
+	`CREATE TABLE undo_journal (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token TEXT NOT NULL UNIQUE,
+		operation TEXT NOT NULL,
+		task_id INTEGER NOT NULL,
+		before TEXT,
+		created_at TEXT NOT NULL,
+		undone_at TEXT
+	);
+	CREATE INDEX idx_undo_journal_task ON undo_journal(task_id);`,
+
+	`CREATE TABLE audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		operation TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		request_id TEXT NOT NULL,
+		before TEXT,
+		after TEXT,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX idx_audit_log_task ON audit_log(task_id, created_at);
+	CREATE INDEX idx_audit_log_created ON audit_log(created_at);`,
+
+	`CREATE TABLE tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE task_tags (
+		task_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (task_id, tag_id)
+	);
+	CREATE INDEX idx_task_tags_tag ON task_tags(tag_id);`,
+
+	`ALTER TABLE scheduler ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;`,
+
+	`CREATE TABLE checklist_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		done INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_checklist_items_task ON checklist_items(task_id);`,
+
+	`CREATE TABLE task_dependencies (
+		task_id INTEGER NOT NULL,
+		depends_on INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (task_id, depends_on)
+	);
+	CREATE INDEX idx_task_dependencies_depends_on ON task_dependencies(depends_on);`,
+
+	`ALTER TABLE scheduler ADD COLUMN status TEXT NOT NULL DEFAULT 'todo';`,
+
+	`CREATE TABLE time_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		started_at TEXT NOT NULL,
+		ended_at TEXT,
+		seconds INTEGER NOT NULL,
+		note TEXT NOT NULL
+	);
+	CREATE INDEX idx_time_entries_task ON time_entries(task_id, started_at);
+	CREATE INDEX idx_time_entries_started ON time_entries(started_at);
+	ALTER TABLE completions ADD COLUMN tracked_seconds INTEGER NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE scheduler ADD COLUMN estimate INTEGER NOT NULL DEFAULT 0;`,
+
+	`CREATE TABLE caldav_objects (
+		name TEXT PRIMARY KEY,
+		task_id INTEGER NOT NULL UNIQUE,
+		uid TEXT NOT NULL
+	);`,
+
+	`CREATE TABLE settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+
+	`ALTER TABLE completions ADD COLUMN last_time_entry_id INTEGER NOT NULL DEFAULT 0;
+	UPDATE completions SET last_time_entry_id = (SELECT coalesce(max(id), 0) FROM time_entries t
+		WHERE t.task_id = completions.task_id AND t.ended_at IS NOT NULL AND t.ended_at <= completions.completed_at);`,
+
+	`ALTER TABLE undo_journal ADD COLUMN after_version INTEGER;`,
+}
+
+// SchemaVersion is the schema version of a fully migrated database.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+func (r *Repository) migrate() error {
+	var version int
+	if err := r.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("the database has schema version %d, newer than this build supports (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting migration %d: %w", i+1, err)
+		}
+		if _, err = tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d: %w", i+1, err)
+		}
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error updating schema version: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
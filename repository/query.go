@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SortDate     = "date"
+	SortTitle    = "title"
+	SortCreated  = "created"
+	SortPriority = "priority"
+
+	RepeatNone      = "none"
+	RepeatRecurring = "recurring"
+)
+
+// sortColumns lists the ORDER BY keys of every sort option. The id is always
+// appended as the last key, so the order is total and cursors are stable.
+// The priority is negated so that important tasks come first in ascending order.
+var sortColumns = map[string][]string{
+	SortDate:     {"date", "-priority"},
+	SortTitle:    {"title"},
+	SortCreated:  {},
+	SortPriority: {"-priority", "date"},
+}
+
+// TaskQuery describes which tasks GetTasks returns and in what order.
+// Zero dates mean no bound; From and To are inclusive.
+type TaskQuery struct {
+	Date   time.Time
+	From   time.Time
+	To     time.Time
+	Repeat string
+	// Statuses keeps tasks in any of the statuses.
+	Statuses []string
+	// MinPriority keeps tasks with at least this priority.
+	MinPriority int
+	// Tags keeps tasks carrying any or, with TagMode TagsAll, all of the tags.
+	Tags    []string
+	TagMode string
+	Sort    string
+	Desc    bool
+	Limit   int
+	Cursor  string
+}
+
+// cursor is the position after the last task of a page. It is handed to
+// clients as an opaque base64 token.
+type cursor struct {
+	Sort string        `json:"s"`
+	Desc bool          `json:"d,omitempty"`
+	Keys []interface{} `json:"k"`
+	ID   int64         `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, NewValidationError("cursor", "Invalid cursor")
+	}
+	return c, nil
+}
+
+// keysetCondition builds "(c1 > ?) OR (c1 = ? AND c2 > ?) OR ..." so that only rows
+// after the cursor position in the given order are selected.
+func keysetCondition(columns []string, values []interface{}, desc bool) (string, []interface{}) {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	var terms []string
+	var args []interface{}
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		parts = append(parts, columns[i]+" "+op+" ?")
+		args = append(args, values[i])
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// GetTasks returns one page of tasks and the cursor of the next page,
+// which is empty when there are no more tasks.
+func (r *Repository) GetTasks(q TaskQuery) ([]Task, string, error) {
+	if q.Sort == "" {
+		q.Sort = SortDate
+	}
+	keys, ok := sortColumns[q.Sort]
+	if !ok {
+		return nil, "", NewValidationError("sort", "Unsupported sort option: "+q.Sort)
+	}
+	columns := append(append([]string{}, keys...), "id")
+
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	if !q.Date.IsZero() {
+		conditions = append(conditions, "date = ?")
+		args = append(args, q.Date.Format("20060102"))
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, q.From.Format("20060102"))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "date <= ?")
+		args = append(args, q.To.Format("20060102"))
+	}
+	switch q.Repeat {
+	case "":
+	case RepeatNone:
+		conditions = append(conditions, "repeat = ''")
+	case RepeatRecurring:
+		conditions = append(conditions, "repeat <> ''")
+	default:
+		return nil, "", NewValidationError("repeat", "The repeat filter must be 'none' or 'recurring'")
+	}
+	if len(q.Statuses) > 0 {
+		for _, status := range q.Statuses {
+			if !validStatus(status) {
+				return nil, "", NewValidationError("status", "The status must be one of: "+strings.Join(Statuses, ", "))
+			}
+			args = append(args, status)
+		}
+		conditions = append(conditions, "status IN ("+placeholders(len(q.Statuses))+")")
+	}
+	if q.MinPriority > 0 {
+		conditions = append(conditions, "priority >= ?")
+		args = append(args, q.MinPriority)
+	}
+	if len(q.Tags) > 0 {
+		tags, err := normalizeTags("tags", q.Tags)
+		if err != nil {
+			return nil, "", err
+		}
+		condition, condArgs, err := tagCondition(tags, q.TagMode)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, condArgs...)
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if c.Sort != q.Sort || c.Desc != q.Desc || len(c.Keys) != len(keys) {
+			return nil, "", NewValidationError("cursor", "The cursor belongs to a different sort order")
+		}
+		for i, key := range keys {
+			if c.Keys[i], ok = cursorKey(key, c.Keys[i]); !ok {
+				return nil, "", NewValidationError("cursor", "Invalid cursor")
+			}
+		}
+		condition, condArgs := keysetCondition(columns, append(c.Keys, c.ID), q.Desc)
+		conditions = append(conditions, condition)
+		args = append(args, condArgs...)
+	}
+
+	query := "SELECT id, date, title, comment, repeat, priority, estimate, status, version FROM scheduler WHERE " + strings.Join(conditions, " AND ")
+	direction := " ASC"
+	if q.Desc {
+		direction = " DESC"
+	}
+	query += " ORDER BY " + strings.Join(columns, direction+", ") + direction + " LIMIT ?"
+	// One extra row tells whether there is a next page.
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		tasks = append(tasks, *task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(tasks) > q.Limit {
+		tasks = tasks[:q.Limit]
+		last := tasks[len(tasks)-1]
+		c := cursor{Sort: q.Sort, Desc: q.Desc, Keys: []interface{}{}}
+		for _, key := range keys {
+			c.Keys = append(c.Keys, last.sortKey(key))
+		}
+		c.ID, _ = strconv.ParseInt(last.ID, 10, 64)
+		next = encodeCursor(c)
+	}
+	if err = attachRelated(r.db, tasks); err != nil {
+		return nil, "", err
+	}
+	return tasks, next, nil
+}
+
+// EachTask calls fn for every task matching q in the order of q, reading them page by
+// page so that exports do not hold all tasks in memory. q.Limit sets the page size.
+func (r *Repository) EachTask(q TaskQuery, fn func(*Task) error) error {
+	if q.Limit <= 0 {
+		q.Limit = 500
+	}
+	for {
+		tasks, next, err := r.GetTasks(q)
+		if err != nil {
+			return err
+		}
+		for i := range tasks {
+			if err = fn(&tasks[i]); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+func (t *Task) sortKey(column string) interface{} {
+	switch column {
+	case "date":
+		return t.Date
+	case "title":
+		return t.Title
+	case "-priority":
+		return -t.Priority
+	}
+	return nil
+}
+
+// cursorKey checks that a key decoded from a cursor has the type of the column's
+// sortKey, so that a forged cursor is not compared with the wrong type.
+func cursorKey(column string, value interface{}) (interface{}, bool) {
+	switch column {
+	case "date", "title":
+		s, ok := value.(string)
+		return s, ok
+	case "-priority":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return nil, false
+		}
+		return int64(n), true
+	}
+	return nil, false
+}
+
+// attachRelated fills in the tags and dependencies of every task in the slice.
+func attachRelated(q queryer, tasks []Task) error {
+	ids := make([]int64, 0, len(tasks))
+	for _, task := range tasks {
+		id, _ := strconv.ParseInt(task.ID, 10, 64)
+		ids = append(ids, id)
+	}
+	tags, err := loadTags(q, ids)
+	if err != nil {
+		return err
+	}
+	deps, err := loadDependencies(q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		tasks[i].Tags = tags[ids[i]]
+		if tasks[i].Tags == nil {
+			tasks[i].Tags = []string{}
+		}
+		if d := deps[ids[i]]; d != nil {
+			tasks[i].DependsOn = d.dependsOn
+			tasks[i].Blockers = d.blockers
+			tasks[i].Blocked = len(d.blockers) > 0
+		}
+	}
+	return nil
+}
+
+func scanTask(rows *sql.Rows) (*Task, error) {
+	var task Task
+	var id int64
+	err := rows.Scan(&id, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Priority, &task.Estimate, &task.Status, &task.Version)
+	if err != nil {
+		return nil, err
+	}
+	task.ID = fmt.Sprintf("%d", id) // Преобразование int64 в string
+	return &task, nil
+}
@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -16,23 +19,99 @@ type Task struct {
 	Title   string `json:"title,omitempty" binding:"required"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	// Priority ranges from 0 (none) to MaxPriority; tasks of one day are listed by priority.
+	// It is omitted when 0 for the clients that read every task field as a string.
+	Priority int `json:"priority,omitempty"`
+	// Estimate is the expected duration in minutes, at most MaxEstimate; 0 means none.
+	Estimate int `json:"estimate,omitempty"`
+	// Status is one of Statuses. On update an empty status leaves it unchanged.
+	Status string `json:"status"`
+	// Version grows with every write; handlers expose it as the ETag.
+	Version   int64  `json:"-"`
+	DeletedAt string `json:"deleted_at,omitempty"`
+	// Tags are kept sorted and read back as an empty list when there are none.
+	// On update a nil slice leaves the tags unchanged and an empty one clears them.
+	Tags []string `json:"tags"`
+	// Checklist is only filled in by GetTask. On update a nil slice leaves it unchanged.
+	Checklist []ChecklistItem `json:"checklist,omitempty"`
+	// DependsOn lists the IDs of prerequisite tasks. On update a nil slice leaves them unchanged.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Blockers are the prerequisites that are still open. They are computed on reads
+	// and ignored on writes, like Blocked.
+	Blockers []string `json:"blockers,omitempty"`
+	Blocked  bool     `json:"blocked,omitempty"`
 }
 
+// Priority levels. Tasks with at least PriorityHigh are the "high priority" ones.
+const (
+	PriorityHigh = 2
+	MaxPriority  = 3
+)
+
+// MaxEstimate is the longest estimate in minutes: a task is planned within a single day.
+const MaxEstimate = 24 * 60
+
 type Repository struct {
-	db *sql.DB
+	db       *sql.DB
+	workflow Workflow
+}
+
+// uriEscaper escapes the characters that end the path of an SQLite file: URI.
+var uriEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// dataSource builds a file: URI for the database at path, so that characters like
+// '?' and '#' in the path do not start the parameters.
+func dataSource(path string, params url.Values) string {
+	return "file:" + uriEscaper.Replace(path) + "?" + params.Encode()
 }
 
 func NewRepository(dbPath string) (*Repository, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// Writers wait for each other instead of failing with "database is locked", and
+	// transactions take the write lock up front because they read before writing.
+	db, err := sql.Open("sqlite3", dataSource(dbPath, url.Values{
+		"_busy_timeout": {"5000"},
+		"_txlock":       {"immediate"},
+	}))
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
-	return &Repository{db: db}, nil
+	repo := &Repository{db: db, workflow: DefaultWorkflow}
+	if err = repo.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// InsertTask adds the task and returns its ID and the undo token of the insert.
+func (r *Repository) InsertTask(ctx context.Context, task *Task) (int64, string, error) {
+	var id int64
+	var undo string
+	err := r.withTx(func(tx *sql.Tx) error {
+		if task.Status == "" {
+			task.Status = StatusTodo
+		}
+		if err := r.workflow.checkEdit(StatusTodo, task.Status); err != nil {
+			return err
+		}
+		var err error
+		if id, err = insertTask(tx, task); err != nil {
+			return err
+		}
+		undo, err = journal(ctx, tx, OpInsert, id, nil)
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return id, undo, nil
 }
 
-func (r *Repository) InsertTask(task *Task) (int64, error) {
-	query := "INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, ?, ?)"
-	res, err := r.db.Exec(query, task.Date, task.Title, task.Comment, task.Repeat)
+// insertTask writes a new task with its tags, checklist and prerequisites, without
+// journaling it.
+func insertTask(tx *sql.Tx, task *Task) (int64, error) {
+	query := "INSERT INTO scheduler (date, title, comment, repeat, priority, estimate, status) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	res, err := tx.Exec(query, task.Date, task.Title, task.Comment, task.Repeat, task.Priority, task.Estimate, task.Status)
 	if err != nil {
 		return 0, fmt.Errorf("error inserting task: %w", err)
 	}
@@ -41,119 +120,360 @@ func (r *Repository) InsertTask(task *Task) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error getting task ID: %w", err)
 	}
+	task.Version = 1
 
-	return id, nil
-}
-
-func (r *Repository) GetTasks(date time.Time, limit int) ([]Task, error) {
-	var query string
-	var args []interface{}
-	if !date.IsZero() {
-		query = "SELECT id, date, title, comment, repeat FROM scheduler WHERE date = ? ORDER BY date ASC LIMIT ?"
-		args = []interface{}{date.Format("20060102"), limit}
-	} else {
-		query = "SELECT id, date, title, comment, repeat FROM scheduler ORDER BY date ASC LIMIT ?"
-		args = []interface{}{limit}
+	if task.Tags, err = normalizeTags("tags", task.Tags); err != nil {
+		return 0, err
 	}
-
-	rows, err := r.db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	if err = setTaskTags(tx, id, task.Tags); err != nil {
+		return 0, err
 	}
-	defer rows.Close()
-
-	var tasks []Task
-	for rows.Next() {
-		var id int64
-		var date, title, comment, repeat string
-		err = rows.Scan(&id, &date, &title, &comment, &repeat)
-		if err != nil {
-			return nil, err
-		}
-
-		task := Task{
-			ID:      fmt.Sprintf("%d", id), // Преобразование int64 в string
-			Date:    date,
-			Title:   title,
-			Comment: comment,
-			Repeat:  repeat,
-		}
-
-		tasks = append(tasks, task)
+	if task.Checklist, err = newChecklist(task.Checklist, nil); err != nil {
+		return 0, err
+	}
+	if err = setChecklist(tx, id, task.Checklist); err != nil {
+		return 0, err
 	}
-	if tasks == nil {
-		tasks = []Task{}
+	if task.Checklist, err = loadChecklist(tx, id); err != nil {
+		return 0, err
 	}
-	return tasks, nil
+	if err = setDependencies(tx, id, task.DependsOn); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
 func (r *Repository) GetTask(id int) (*Task, error) {
 	var task Task
-	row := r.db.QueryRow("SELECT id, date, title, comment, repeat FROM scheduler WHERE id = ?", id)
-	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	row := r.db.QueryRow("SELECT id, date, title, comment, repeat, priority, estimate, status, version FROM scheduler WHERE id = ? AND deleted_at IS NULL", id)
+	err := row.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Priority, &task.Estimate, &task.Status, &task.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("task not found")
+			return nil, ErrTaskNotFound
 		}
 		return nil, fmt.Errorf("error receiving task data: %w", err)
 	}
+	tasks := []Task{task}
+	if err = attachRelated(r.db, tasks); err != nil {
+		return nil, err
+	}
+	task = tasks[0]
+	if task.Checklist, err = loadChecklist(r.db, int64(id)); err != nil {
+		return nil, err
+	}
 	return &task, nil
 }
 
-func (r *Repository) UpdateTask(task *Task) (int64, error) {
-	result, err := r.db.Exec("UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ? WHERE id = ?",
-		task.Date, task.Title, task.Comment, task.Repeat, task.ID)
+// TaskUpdate is a full replacement of a task. Priority and Estimate were added after the
+// first clients and are omitted from responses when 0, so, like the tags, they are left
+// unchanged when missing from the request; an explicit 0 clears them.
+type TaskUpdate struct {
+	Task
+	Priority *int `json:"priority"`
+	Estimate *int `json:"estimate"`
+}
+
+// UpdateTask replaces the task. A non-zero task.Version must match the stored one,
+// otherwise ErrVersionMismatch is returned. On success task holds the stored task,
+// with the new version.
+func (r *Repository) UpdateTask(ctx context.Context, update *TaskUpdate) (string, error) {
+	task := &update.Task
+	return r.mutate(ctx, OpUpdate, task.ID, task.Version, func(tx *sql.Tx, before *taskSnapshot) error {
+		if task.Status == "" {
+			task.Status = before.Status
+		}
+		task.Priority, task.Estimate = before.Priority, before.Estimate
+		if update.Priority != nil {
+			task.Priority = *update.Priority
+		}
+		if update.Estimate != nil {
+			task.Estimate = *update.Estimate
+		}
+		if err := r.workflow.checkEdit(before.Status, task.Status); err != nil {
+			return err
+		}
+		err := tx.QueryRow("UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ?, priority = ?, estimate = ?, status = ?, version = version + 1 WHERE id = ? RETURNING version",
+			task.Date, task.Title, task.Comment, task.Repeat, task.Priority, task.Estimate, task.Status, task.ID).Scan(&task.Version)
+		if err != nil {
+			return fmt.Errorf("task update error: %w", err)
+		}
+		if task.Tags == nil {
+			task.Tags = before.Tags
+		} else {
+			if task.Tags, err = normalizeTags("tags", task.Tags); err != nil {
+				return err
+			}
+			if err = setTaskTags(tx, before.ID, task.Tags); err != nil {
+				return err
+			}
+		}
+		if task.DependsOn != nil {
+			if err = setDependencies(tx, before.ID, task.DependsOn); err != nil {
+				return err
+			}
+		}
+		if task.Checklist == nil {
+			task.Checklist = before.Checklist
+			return nil
+		}
+		if task.Checklist, err = newChecklist(task.Checklist, before.Checklist); err != nil {
+			return err
+		}
+		if err = setChecklist(tx, before.ID, task.Checklist); err != nil {
+			return err
+		}
+		task.Checklist, err = loadChecklist(tx, before.ID)
+		return err
+	})
+}
+
+// TaskPatch lists the fields of a partial update. Nil fields are left unchanged.
+type TaskPatch struct {
+	Date     *string
+	Title    *string
+	Comment  *string
+	Repeat   *string
+	Priority *int
+	Estimate *int
+	Status   *string
+	// Tags, Checklist and DependsOn replace the current ones unless nil; an empty slice clears them.
+	Tags      []string
+	Checklist []ChecklistItem
+	DependsOn []string
+	// Version, if non-zero, is the version the client expects to overwrite.
+	Version int64
+	// DateRules, if set, checks the date and repeat rule when the patch changes either. It runs
+	// in the write transaction on the stored task with the patch applied and may move the date.
+	DateRules func(task *Task) error
+}
+
+func (r *Repository) PatchTask(ctx context.Context, id int64, patch *TaskPatch) (*Task, string, error) {
+	undo, err := r.mutate(ctx, OpUpdate, id, patch.Version, func(tx *sql.Tx, before *taskSnapshot) error {
+		return r.patchTx(tx, before, patch)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("task update error: %w", err)
+		return nil, "", err
 	}
+	task, err := r.GetTask(int(id))
+	return task, undo, err
+}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, fmt.Errorf("error getting the number of modified rows: %w", err)
+// patchTx writes the fields of the patch that are set.
+func (r *Repository) patchTx(tx *sql.Tx, before *taskSnapshot, patch *TaskPatch) error {
+	if patch.DateRules != nil && (patch.Date != nil || patch.Repeat != nil) {
+		task := before.task()
+		if patch.Date != nil {
+			task.Date = *patch.Date
+		}
+		if patch.Repeat != nil {
+			task.Repeat = *patch.Repeat
+		}
+		if err := patch.DateRules(task); err != nil {
+			return err
+		}
+		patch.Date = &task.Date
 	}
 
-	if rowsAffected == 0 {
-		return 0, fmt.Errorf("task not found")
+	var sets []string
+	var args []interface{}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"date", patch.Date},
+		{"title", patch.Title},
+		{"comment", patch.Comment},
+		{"repeat", patch.Repeat},
+		{"status", patch.Status},
+	} {
+		if field.value != nil {
+			sets = append(sets, field.column+" = ?")
+			args = append(args, *field.value)
+		}
+	}
+	if patch.Priority != nil {
+		sets = append(sets, "priority = ?")
+		args = append(args, *patch.Priority)
+	}
+	if patch.Estimate != nil {
+		sets = append(sets, "estimate = ?")
+		args = append(args, *patch.Estimate)
 	}
+	sets = append(sets, "version = version + 1")
+	args = append(args, before.ID)
 
-	return rowsAffected, nil
+	if patch.Status != nil {
+		if err := r.workflow.checkEdit(before.Status, *patch.Status); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("UPDATE scheduler SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...)
+	if err != nil {
+		return fmt.Errorf("task update error: %w", err)
+	}
+	if patch.Tags != nil {
+		tags, err := normalizeTags("tags", patch.Tags)
+		if err != nil {
+			return err
+		}
+		if err = setTaskTags(tx, before.ID, tags); err != nil {
+			return err
+		}
+	}
+	if patch.DependsOn != nil {
+		if err = setDependencies(tx, before.ID, patch.DependsOn); err != nil {
+			return err
+		}
+	}
+	if patch.Checklist == nil {
+		return nil
+	}
+	items, err := newChecklist(patch.Checklist, before.Checklist)
+	if err != nil {
+		return err
+	}
+	return setChecklist(tx, before.ID, items)
 }
 
-func (r *Repository) MarkTaskDone(id int64) error {
-	var task Task
-	err := r.db.QueryRow("SELECT * FROM scheduler WHERE id = ?", id).Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("task not found")
+// MarkTaskDone moves a recurring task to its next date, unticking its checklist, and deletes
+// a one-off task. Either way the completion is added to the history. A non-zero version must
+// match the stored one. A task with open prerequisites is only completed when forced.
+// Unlike SetTaskStatus it does not consult the workflow.
+func (r *Repository) MarkTaskDone(ctx context.Context, id int64, version int64, force bool) (string, error) {
+	return r.mutate(ctx, OpDone, id, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		return complete(tx, before, force, false)
+	})
+}
+
+// complete records the completion of a task. A recurring task moves to its next date in
+// status todo with its checklist unticked; a one-off task is marked done if keep is set
+// and deleted otherwise.
+func complete(tx *sql.Tx, before *taskSnapshot, force, keep bool) error {
+	task := before.task()
+
+	if !force {
+		deps, err := loadDependencies(tx, []int64{before.ID})
+		if err != nil {
+			return err
+		}
+		if d := deps[before.ID]; d != nil && len(d.blockers) > 0 {
+			return fmt.Errorf("%w: the task is blocked by open prerequisites: %s", ErrConflict, strings.Join(d.blockers, ", "))
 		}
-		return fmt.Errorf("error receiving the task: %w", err)
 	}
 
-	if task.Repeat != "" {
-		nextDate, err := taskRepRules.NextDate(time.Now(), task.Date, task.Repeat) // Assuming you have a NextDate function defined
+	if err := insertCompletion(tx, task); err != nil {
+		return err
+	}
+
+	switch {
+	case task.Repeat != "":
+		nextDate, err := taskRepRules.NextDate(time.Now(), task.Date, task.Repeat)
 		if err != nil {
 			return fmt.Errorf("error in calculating the next date: %w", err)
 		}
 		task.Date = nextDate
 
-		_, err = r.db.Exec("UPDATE scheduler SET date = ? WHERE id = ?", task.Date, task.ID)
+		_, err = tx.Exec("UPDATE scheduler SET date = ?, status = ?, version = version + 1 WHERE id = ?", task.Date, StatusTodo, task.ID)
 		if err != nil {
 			return fmt.Errorf("error updating the task: %w", err)
 		}
-	} else {
-		_, err = r.db.Exec("DELETE FROM scheduler WHERE id = ?", task.ID)
+		_, err = tx.Exec("UPDATE checklist_items SET done = 0 WHERE task_id = ?", task.ID)
 		if err != nil {
-			return fmt.Errorf("error deleting a task: %w", err)
+			return fmt.Errorf("error resetting the checklist: %w", err)
 		}
+	case keep:
+		_, err := tx.Exec("UPDATE scheduler SET status = ?, version = version + 1 WHERE id = ?", StatusDone, task.ID)
+		if err != nil {
+			return fmt.Errorf("error updating the task: %w", err)
+		}
+	default:
+		return deleteTaskRow(tx, before.ID)
 	}
 	return nil
 }
 
-func (r *Repository) DeleteTask(id int64) error {
-	_, err := r.db.Exec("DELETE FROM scheduler WHERE id = ?", id)
+// DeleteTask moves the task to the trash. A non-zero version must match the stored one.
+func (r *Repository) DeleteTask(ctx context.Context, id int64, version int64) (string, error) {
+	return r.mutate(ctx, OpDelete, id, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		_, err := tx.Exec("UPDATE scheduler SET deleted_at = ?, version = version + 1 WHERE id = ?",
+			time.Now().UTC().Format(time.RFC3339), id)
+		if err != nil {
+			return fmt.Errorf("error deleting a task: %w", err)
+		}
+		return nil
+	})
+}
+
+// mutate runs a write to one live task in a transaction and journals it for undo and audit.
+// A non-zero version must match the stored one.
+func (r *Repository) mutate(ctx context.Context, op string, id interface{}, version int64,
+	write func(tx *sql.Tx, before *taskSnapshot) error) (string, error) {
+	var undo string
+	err := r.withTx(func(tx *sql.Tx) error {
+		var err error
+		undo, err = mutateTx(ctx, tx, op, id, version, write)
+		return err
+	})
+	return undo, err
+}
+
+// mutateTx is mutate within a transaction that the caller commits.
+func mutateTx(ctx context.Context, tx *sql.Tx, op string, id interface{}, version int64,
+	write func(tx *sql.Tx, before *taskSnapshot) error) (string, error) {
+	before, err := loadForWrite(tx, id, version)
+	if err != nil {
+		return "", err
+	}
+	if err = write(tx, before); err != nil {
+		return "", err
+	}
+	return journal(ctx, tx, op, before.ID, before)
+}
+
+// journal records a write in the undo journal and the audit log and returns the undo token.
+func journal(ctx context.Context, tx *sql.Tx, op string, taskID int64, before *taskSnapshot) (string, error) {
+	undo, err := recordUndo(tx, op, taskID, before)
 	if err != nil {
+		return "", err
+	}
+	if err = recordAudit(ctx, tx, op, taskID, before); err != nil {
+		return "", err
+	}
+	return undo, nil
+}
+
+// deleteTaskRow permanently removes the scheduler row and the rows that belong to it.
+func deleteTaskRow(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec("DELETE FROM scheduler WHERE id = ?", id); err != nil {
 		return fmt.Errorf("error deleting a task: %w", err)
 	}
+	if _, err := tx.Exec("DELETE FROM task_tags WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("error deleting task tags: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM checklist_items WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("error deleting the checklist: %w", err)
+	}
+	// Dependencies on this task are kept: they stop blocking once the task is gone
+	// and come back into effect if an undo recreates it.
+	if _, err := tx.Exec("DELETE FROM task_dependencies WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("error deleting task dependencies: %w", err)
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling back otherwise.
+func (r *Repository) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
 	return nil
 }
 
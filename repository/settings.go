@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	settingPasswordHash  = "password_hash"
+	settingSessionSecret = "session_secret"
+)
+
+// Password hashes are stored as "pbkdf2-sha256$<iterations>$<salt>$<key>" in hex.
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordKeyLength  = 32
+)
+
+// PasswordHash returns the hash stored by SetPassword, or "" if there is none.
+func (r *Repository) PasswordHash() (string, error) {
+	var hash string
+	err := r.db.QueryRow("SELECT value FROM settings WHERE key = ?", settingPasswordHash).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error receiving settings: %w", err)
+	}
+	return hash, nil
+}
+
+// SetPassword stores the hash of the password, which then takes the place of TODO_PASSWORD.
+// An empty password removes the stored hash. Either way the session secret is replaced,
+// so everyone signed in has to sign in again.
+func (r *Repository) SetPassword(password string) error {
+	hash := ""
+	if password != "" {
+		var err error
+		if hash, err = HashPassword(password); err != nil {
+			return err
+		}
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	return r.withTx(func(tx *sql.Tx) error {
+		if hash == "" {
+			_, err = tx.Exec("DELETE FROM settings WHERE key = ?", settingPasswordHash)
+		} else {
+			_, err = tx.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", settingPasswordHash, hash)
+		}
+		if err == nil {
+			_, err = tx.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", settingSessionSecret, secret)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating settings: %w", err)
+		}
+		return nil
+	})
+}
+
+// SessionSecret returns the key that signs web UI sessions, creating it on first use.
+func (r *Repository) SessionSecret() (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.db.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES (?, ?)", settingSessionSecret, secret)
+	if err != nil {
+		return "", fmt.Errorf("error updating settings: %w", err)
+	}
+	if err = r.db.QueryRow("SELECT value FROM settings WHERE key = ?", settingSessionSecret).Scan(&secret); err != nil {
+		return "", fmt.Errorf("error receiving settings: %w", err)
+	}
+	return secret, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashPassword derives a salted hash of the password for VerifyPassword.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+	key := pbkdf2.Key([]byte(password), salt, passwordIterations, passwordKeyLength, sha256.New)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether the password matches a hash made by HashPassword.
+func VerifyPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	if len(key) == 0 {
+		return false
+	}
+	return hmac.Equal(pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New), key)
+}
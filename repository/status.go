@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Task statuses. A one-off task stays in StatusDone once completed, a recurring task
+// moves to its next date and starts over in StatusTodo.
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusWaiting    = "waiting"
+	StatusDone       = "done"
+)
+
+// Statuses lists all statuses in board order.
+var Statuses = []string{StatusTodo, StatusInProgress, StatusWaiting, StatusDone}
+
+// Workflow maps a status to the statuses a task may move to from it.
+type Workflow map[string][]string
+
+// DefaultWorkflow allows any move except reopening a done task into anything but todo.
+var DefaultWorkflow = Workflow{
+	StatusTodo:       {StatusInProgress, StatusWaiting, StatusDone},
+	StatusInProgress: {StatusTodo, StatusWaiting, StatusDone},
+	StatusWaiting:    {StatusTodo, StatusInProgress, StatusDone},
+	StatusDone:       {StatusTodo},
+}
+
+// ParseWorkflow reads transitions written as "todo:in_progress,done;in_progress:done;...".
+// Statuses without an entry cannot be left.
+func ParseWorkflow(s string) (Workflow, error) {
+	workflow := Workflow{}
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		from, targets, ok := strings.Cut(rule, ":")
+		from = strings.TrimSpace(from)
+		if !ok || !validStatus(from) {
+			return nil, fmt.Errorf("invalid workflow rule %q", rule)
+		}
+		for _, to := range strings.Split(targets, ",") {
+			to = strings.TrimSpace(to)
+			if !validStatus(to) {
+				return nil, fmt.Errorf("unknown status %q in workflow rule %q", to, rule)
+			}
+			workflow[from] = append(workflow[from], to)
+		}
+	}
+	return workflow, nil
+}
+
+func validStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Transitions returns the statuses a task in the given status may move to.
+func (w Workflow) Transitions(from string) []string {
+	if w[from] == nil {
+		return []string{}
+	}
+	return w[from]
+}
+
+func (w Workflow) check(from, to string) error {
+	if !validStatus(to) {
+		return NewValidationError("status", "The status must be one of: "+strings.Join(Statuses, ", "))
+	}
+	if from == to {
+		return nil
+	}
+	for _, allowed := range w[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: a task cannot move from %s to %s", ErrConflict, from, to)
+}
+
+// checkEdit validates a status set by PUT or PATCH. Completion also records history
+// and reschedules recurring tasks, so it is left to SetTaskStatus and MarkTaskDone.
+func (w Workflow) checkEdit(from, to string) error {
+	if to == StatusDone && from != StatusDone {
+		return NewValidationError("status", "Use the status or done endpoint to complete a task")
+	}
+	return w.check(from, to)
+}
+
+// SetWorkflow replaces the allowed status transitions.
+func (r *Repository) SetWorkflow(workflow Workflow) {
+	r.workflow = workflow
+}
+
+// Workflow returns the allowed status transitions.
+func (r *Repository) Workflow() Workflow {
+	return r.workflow
+}
+
+// SetTaskStatus moves a task to another status if the workflow allows it. Moving to done
+// completes the task like MarkTaskDone, except that a one-off task is kept with status done.
+func (r *Repository) SetTaskStatus(ctx context.Context, id int64, version int64, status string, force bool) (string, error) {
+	op := OpUpdate
+	if status == StatusDone {
+		op = OpDone
+	}
+	return r.mutate(ctx, op, id, version, func(tx *sql.Tx, before *taskSnapshot) error {
+		if err := r.workflow.check(before.Status, status); err != nil {
+			return err
+		}
+		if before.Status == status {
+			if status == StatusDone {
+				return fmt.Errorf("%w: the task is already done", ErrConflict)
+			}
+			return nil
+		}
+		if status == StatusDone {
+			return complete(tx, before, force, true)
+		}
+		_, err := tx.Exec("UPDATE scheduler SET status = ?, version = version + 1 WHERE id = ?", status, id)
+		if err != nil {
+			return fmt.Errorf("task update error: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tag filter modes of TaskQuery.
+const (
+	TagsAny = "any"
+	TagsAll = "all"
+)
+
+const maxTagLength = 50
+
+// TagCount is a tag together with the number of live tasks carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// normalizeTags lowercases and trims tag names and drops duplicates.
+// Empty and overlong names are rejected as a validation error of field.
+func normalizeTags(field string, tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, NewValidationError(field, "Tag names cannot be empty")
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, NewValidationError(field, fmt.Sprintf("Tag names cannot be longer than %d characters", maxTagLength))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// setTaskTags replaces the tags of a task, creating tags that do not exist yet.
+func setTaskTags(tx *sql.Tx, taskID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM task_tags WHERE task_id = ?", taskID); err != nil {
+		return fmt.Errorf("error updating task tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return fmt.Errorf("error creating tag: %w", err)
+		}
+		_, err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", taskID, tag)
+		if err != nil {
+			return fmt.Errorf("error updating task tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadTags returns the tags of the given tasks by task ID, sorted by name.
+// Tasks without tags are missing from the map.
+func loadTags(q queryer, ids []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query("SELECT task_tags.task_id, tags.name FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE task_tags.task_id IN ("+
+		placeholders(len(ids))+") ORDER BY tags.name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving task tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], name)
+	}
+	return tags, rows.Err()
+}
+
+// tagCondition selects the tasks that carry any or all of the tags.
+func tagCondition(tags []string, mode string) (string, []interface{}, error) {
+	var args []interface{}
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	query := "SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name IN (" + placeholders(len(tags)) + ")"
+	switch mode {
+	case "", TagsAny:
+	case TagsAll:
+		query += " GROUP BY task_tags.task_id HAVING count(*) = ?"
+		args = append(args, len(tags))
+	default:
+		return "", nil, NewValidationError("tag_mode", "The tag mode must be 'any' or 'all'")
+	}
+	return "id IN (" + query + ")", args, nil
+}
+
+// GetTags lists the tags of live tasks in alphabetical order.
+func (r *Repository) GetTags() ([]TagCount, error) {
+	rows, err := r.db.Query(`SELECT tags.name, count(*) FROM tags
+		JOIN task_tags ON task_tags.tag_id = tags.id
+		JOIN scheduler ON scheduler.id = task_tags.task_id AND scheduler.deleted_at IS NULL
+		GROUP BY tags.id ORDER BY tags.name`)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err = rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Time report groupings.
+const (
+	GroupDay  = "day"
+	GroupWeek = "week"
+)
+
+// TimeEntry is time spent on a task, either measured by a timer or entered by hand.
+// A running timer has no EndedAt; its Seconds grow until it is stopped.
+// Entries outlive their task, so that billed time is not lost when a task is completed.
+type TimeEntry struct {
+	ID        string `json:"id"`
+	TaskID    string `json:"task_id"`
+	StartedAt string `json:"started_at"`
+	EndedAt   string `json:"ended_at,omitempty"`
+	Seconds   int64  `json:"seconds"`
+	Note      string `json:"note,omitempty"`
+}
+
+// TimePeriod is the time tracked in one day or week, which starts on Monday.
+type TimePeriod struct {
+	Start   string `json:"start"`
+	Seconds int64  `json:"seconds"`
+}
+
+// TaskTime is the time tracked on one task.
+type TaskTime struct {
+	TaskID  string `json:"task_id"`
+	Seconds int64  `json:"seconds"`
+}
+
+// TimeReport sums up tracked time by period and by task.
+type TimeReport struct {
+	Periods      []TimePeriod `json:"periods"`
+	Tasks        []TaskTime   `json:"tasks"`
+	TotalSeconds int64        `json:"total_seconds"`
+}
+
+// TimeReportQuery filters GetTimeReport. A zero TaskID selects all tasks,
+// zero dates mean no bound and From and To are inclusive days in local time.
+type TimeReportQuery struct {
+	TaskID int64
+	From   time.Time
+	To     time.Time
+	Group  string
+}
+
+const timeEntryColumns = "id, task_id, started_at, ended_at, seconds, note"
+
+func scanTimeEntry(scan func(dest ...interface{}) error, now time.Time) (*TimeEntry, error) {
+	var e TimeEntry
+	var id, taskID int64
+	var endedAt sql.NullString
+	if err := scan(&id, &taskID, &e.StartedAt, &endedAt, &e.Seconds, &e.Note); err != nil {
+		return nil, err
+	}
+	e.ID = fmt.Sprintf("%d", id)
+	e.TaskID = fmt.Sprintf("%d", taskID)
+	if endedAt.Valid {
+		e.EndedAt = endedAt.String
+	} else if started, err := time.Parse(time.RFC3339, e.StartedAt); err == nil {
+		e.Seconds = int64(now.Sub(started).Seconds())
+	}
+	return &e, nil
+}
+
+func liveTaskExists(tx *sql.Tx, taskID int64) error {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM scheduler WHERE id = ? AND deleted_at IS NULL)", taskID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error receiving task data: %w", err)
+	}
+	if !exists {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// StartTimer starts measuring time on a task. A task has at most one running timer.
+func (r *Repository) StartTimer(taskID int64) (*TimeEntry, error) {
+	var entry *TimeEntry
+	err := r.withTx(func(tx *sql.Tx) error {
+		if err := liveTaskExists(tx, taskID); err != nil {
+			return err
+		}
+		var running bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM time_entries WHERE task_id = ? AND ended_at IS NULL)", taskID).Scan(&running)
+		if err != nil {
+			return fmt.Errorf("error receiving time entries: %w", err)
+		}
+		if running {
+			return fmt.Errorf("%w: a timer is already running on the task", ErrConflict)
+		}
+		now := time.Now().UTC()
+		res, err := tx.Exec("INSERT INTO time_entries (task_id, started_at, seconds, note) VALUES (?, ?, 0, '')", taskID, now.Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("error starting the timer: %w", err)
+		}
+		id, _ := res.LastInsertId()
+		entry, err = scanTimeEntry(tx.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE id = ?", id).Scan, now)
+		return err
+	})
+	return entry, err
+}
+
+// StopTimer stops the running timer of a task and returns the finished entry.
+func (r *Repository) StopTimer(taskID int64) (*TimeEntry, error) {
+	var entry *TimeEntry
+	err := r.withTx(func(tx *sql.Tx) error {
+		id, err := stopTimer(tx, taskID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			return fmt.Errorf("%w: no timer is running on the task", ErrConflict)
+		}
+		entry, err = scanTimeEntry(tx.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE id = ?", id).Scan, time.Now())
+		return err
+	})
+	return entry, err
+}
+
+// stopTimer finishes the running timer of a task, if any, and returns the ID of its entry.
+func stopTimer(tx *sql.Tx, taskID int64, now time.Time) (int64, error) {
+	var id int64
+	var startedAt string
+	err := tx.QueryRow("SELECT id, started_at FROM time_entries WHERE task_id = ? AND ended_at IS NULL", taskID).Scan(&id, &startedAt)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error receiving time entries: %w", err)
+	}
+	started, err := time.Parse(time.RFC3339, startedAt)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timer start %q: %w", startedAt, err)
+	}
+	_, err = tx.Exec("UPDATE time_entries SET ended_at = ?, seconds = ? WHERE id = ?",
+		now.Format(time.RFC3339), int64(now.Sub(started).Seconds()), id)
+	if err != nil {
+		return 0, fmt.Errorf("error stopping the timer: %w", err)
+	}
+	return id, nil
+}
+
+// AddTimeEntry records time spent on a task by hand. The entry ends StartedAt plus
+// Seconds later; without StartedAt it ends now.
+func (r *Repository) AddTimeEntry(taskID int64, entry *TimeEntry) (*TimeEntry, error) {
+	if entry.Seconds <= 0 {
+		return nil, NewValidationError("seconds", "The tracked time must be positive")
+	}
+	duration := time.Duration(entry.Seconds) * time.Second
+	started := time.Now().UTC().Add(-duration)
+	if entry.StartedAt != "" {
+		var err error
+		started, err = time.Parse(time.RFC3339, entry.StartedAt)
+		if err != nil {
+			return nil, NewValidationError("started_at", "The start must be an RFC 3339 timestamp")
+		}
+		started = started.UTC()
+	}
+
+	var result *TimeEntry
+	err := r.withTx(func(tx *sql.Tx) error {
+		if err := liveTaskExists(tx, taskID); err != nil {
+			return err
+		}
+		res, err := tx.Exec("INSERT INTO time_entries (task_id, started_at, ended_at, seconds, note) VALUES (?, ?, ?, ?, ?)",
+			taskID, started.Format(time.RFC3339), started.Add(duration).Format(time.RFC3339), entry.Seconds, entry.Note)
+		if err != nil {
+			return fmt.Errorf("error adding a time entry: %w", err)
+		}
+		id, _ := res.LastInsertId()
+		result, err = scanTimeEntry(tx.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE id = ?", id).Scan, time.Now())
+		return err
+	})
+	return result, err
+}
+
+// DeleteTimeEntry removes a time entry of a task.
+func (r *Repository) DeleteTimeEntry(taskID, entryID int64) error {
+	res, err := r.db.Exec("DELETE FROM time_entries WHERE id = ? AND task_id = ?", entryID, taskID)
+	if err != nil {
+		return fmt.Errorf("error deleting a time entry: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTimeEntryNotFound
+	}
+	return nil
+}
+
+// GetTimeEntries returns the time entries of a task, latest first, and their total.
+func (r *Repository) GetTimeEntries(taskID int64) ([]TimeEntry, int64, error) {
+	rows, err := r.db.Query("SELECT "+timeEntryColumns+" FROM time_entries WHERE task_id = ? ORDER BY started_at DESC, id DESC", taskID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error receiving time entries: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	entries := []TimeEntry{}
+	var total int64
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows.Scan, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+		total += entry.Seconds
+	}
+	return entries, total, rows.Err()
+}
+
+// GetTimeReport sums up tracked time by the local day or week in which each entry started.
+func (r *Repository) GetTimeReport(q TimeReportQuery) (*TimeReport, error) {
+	if q.Group == "" {
+		q.Group = GroupDay
+	}
+	if q.Group != GroupDay && q.Group != GroupWeek {
+		return nil, NewValidationError("group", "The grouping must be 'day' or 'week'")
+	}
+	query := "SELECT " + timeEntryColumns + " FROM time_entries WHERE 1 = 1"
+	var args []interface{}
+	if q.TaskID != 0 {
+		query += " AND task_id = ?"
+		args = append(args, q.TaskID)
+	}
+	if !q.From.IsZero() {
+		from := time.Date(q.From.Year(), q.From.Month(), q.From.Day(), 0, 0, 0, 0, time.Local)
+		query += " AND started_at >= ?"
+		args = append(args, from.UTC().Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		to := time.Date(q.To.Year(), q.To.Month(), q.To.Day()+1, 0, 0, 0, 0, time.Local)
+		query += " AND started_at < ?"
+		args = append(args, to.UTC().Format(time.RFC3339))
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error receiving time entries: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	periods := map[string]int64{}
+	tasks := map[string]int64{}
+	report := &TimeReport{Periods: []TimePeriod{}, Tasks: []TaskTime{}}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows.Scan, now)
+		if err != nil {
+			return nil, err
+		}
+		started, err := time.Parse(time.RFC3339, entry.StartedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time entry start %q: %w", entry.StartedAt, err)
+		}
+		day := started.In(time.Local)
+		if q.Group == GroupWeek {
+			day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		}
+		periods[day.Format("20060102")] += entry.Seconds
+		tasks[entry.TaskID] += entry.Seconds
+		report.TotalSeconds += entry.Seconds
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for start, seconds := range periods {
+		report.Periods = append(report.Periods, TimePeriod{Start: start, Seconds: seconds})
+	}
+	sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Start < report.Periods[j].Start })
+	for id, seconds := range tasks {
+		report.Tasks = append(report.Tasks, TaskTime{TaskID: id, Seconds: seconds})
+	}
+	sort.Slice(report.Tasks, func(i, j int) bool {
+		if report.Tasks[i].Seconds != report.Tasks[j].Seconds {
+			return report.Tasks[i].Seconds > report.Tasks[j].Seconds
+		}
+		return report.Tasks[i].TaskID < report.Tasks[j].TaskID
+	})
+	return report, nil
+}
+
+// trackedAfter sums up the finished time entries of a task recorded after the entry
+// with the given ID, and returns the sum and the ID of the last entry counted.
+func trackedAfter(tx *sql.Tx, taskID, after int64) (int64, int64, error) {
+	var seconds, last int64
+	err := tx.QueryRow("SELECT coalesce(sum(seconds), 0), coalesce(max(id), ?) FROM time_entries WHERE task_id = ? AND ended_at IS NOT NULL AND id > ?",
+		after, taskID, after).Scan(&seconds, &last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error receiving time entries: %w", err)
+	}
+	return seconds, last, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+
+	TokenPrefix = "fpt_"
+)
+
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+}
+
+// HasScope reports whether the token grants the scope. Write access implies read access.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || (s == ScopeWrite && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken stores a new token and returns it together with its secret.
+// Only the hash of the secret is kept, so it cannot be shown again.
+func (r *Repository) CreateAPIToken(name string, scopes []string) (*APIToken, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("error generating token: %w", err)
+	}
+	secret := TokenPrefix + hex.EncodeToString(buf)
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+
+	res, err := r.db.Exec("INSERT INTO api_tokens (name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?)",
+		name, hashToken(secret), strings.Join(scopes, ","), createdAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("error inserting token: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting token ID: %w", err)
+	}
+
+	token := &APIToken{
+		ID:        fmt.Sprintf("%d", id),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: createdAt,
+	}
+	return token, secret, nil
+}
+
+func (r *Repository) ListAPITokens() ([]APIToken, error) {
+	rows, err := r.db.Query("SELECT id, name, scopes, created_at, last_used_at FROM api_tokens ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var token APIToken
+		var scopes string
+		var lastUsed sql.NullString
+		if err = rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Split(scopes, ",")
+		token.LastUsedAt = lastUsed.String
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// LookupAPIToken finds the token by its secret and records the time of use.
+func (r *Repository) LookupAPIToken(secret string) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	var lastUsed sql.NullString
+	hash := hashToken(secret)
+	err := r.db.QueryRow("SELECT id, name, scopes, created_at, last_used_at FROM api_tokens WHERE token_hash = ?", hash).
+		Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &lastUsed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("error receiving token: %w", err)
+	}
+	token.Scopes = strings.Split(scopes, ",")
+
+	token.LastUsedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = r.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?", token.LastUsedAt, hash)
+	if err != nil {
+		return nil, fmt.Errorf("error updating token: %w", err)
+	}
+	return &token, nil
+}
+
+func (r *Repository) RevokeAPIToken(id int64) error {
+	res, err := r.db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("error revoking token: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting the number of modified rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetTrash returns deleted tasks, most recently deleted first.
+func (r *Repository) GetTrash(limit int) ([]Task, error) {
+	rows, err := r.db.Query("SELECT id, date, title, comment, repeat, priority, estimate, status, version, deleted_at FROM scheduler WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		var task Task
+		err = rows.Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Priority, &task.Estimate, &task.Status, &task.Version, &task.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, attachRelated(r.db, tasks)
+}
+
+// RestoreTask takes the task out of the trash.
+func (r *Repository) RestoreTask(ctx context.Context, id int64) error {
+	return r.withTx(func(tx *sql.Tx) error {
+		before, err := loadSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.DeletedAt == nil {
+			return ErrTaskNotFound
+		}
+		_, err = tx.Exec("UPDATE scheduler SET deleted_at = NULL, version = version + 1 WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("error restoring a task: %w", err)
+		}
+		return recordAudit(ctx, tx, OpRestore, id, before)
+	})
+}
+
+// PurgeTask permanently deletes a task that is in the trash.
+func (r *Repository) PurgeTask(ctx context.Context, id int64) error {
+	return r.withTx(func(tx *sql.Tx) error {
+		before, err := loadSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.DeletedAt == nil {
+			return ErrTaskNotFound
+		}
+		return purge(ctx, tx, before)
+	})
+}
+
+// PurgeTrash permanently deletes tasks that were moved to the trash before the given time.
+func (r *Repository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id FROM scheduler WHERE deleted_at IS NOT NULL AND deleted_at < ?", before.UTC().Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("error emptying the trash: %w", err)
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			snapshot, err := loadSnapshot(tx, id)
+			if err != nil {
+				return err
+			}
+			if err = purge(ctx, tx, snapshot); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(ids))
+		return nil
+	})
+	return purged, err
+}
+
+func purge(ctx context.Context, tx *sql.Tx, task *taskSnapshot) error {
+	if err := deleteTaskRow(tx, task.ID); err != nil {
+		return err
+	}
+	return recordAudit(ctx, tx, OpPurge, task.ID, task)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"final_project/handlers"
+	"final_project/repository"
+)
+
+// purgeTrash permanently deletes tasks that have been in the trash longer than retention.
+func purgeTrash(repo *repository.Repository, retention time.Duration) {
+	for {
+		purged, err := repo.PurgeTrash(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error emptying the trash: %s", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d tasks from the trash", purged)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// pruneUndoJournal forgets the undo entries older than retention, whose tokens then stop working.
+func pruneUndoJournal(repo *repository.Repository, retention time.Duration) {
+	for {
+		pruned, err := repo.PruneUndoJournal(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error pruning the undo journal: %s", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d entries from the undo journal", pruned)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// scheduleBackups snapshots the database every interval and deletes the backups beyond keep.
+func scheduleBackups(repo *repository.Repository, dir string, interval time.Duration, keep int) {
+	for {
+		time.Sleep(interval)
+		path, err := repo.Backup(context.Background(), dir)
+		if err != nil {
+			log.Printf("Error backing up the database: %s", err)
+			continue
+		}
+		log.Printf("Database backed up to %s", path)
+		if _, err = repository.PruneBackups(dir, keep); err != nil {
+			log.Printf("Error deleting old backups: %s", err)
+		}
+	}
+}
+
+func serve(args []string) error {
+	var dbFile, port, webDir string
+	flags := newFlagSet("serve", &dbFile)
+	serverFlags(flags, &port, &webDir)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if err := checkPort(port); err != nil {
+		return err
+	}
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+
+	repo, err := repository.NewRepository(dbFile)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	if s.workflow != nil {
+		repo.SetWorkflow(*s.workflow)
+	}
+	passwordHash, err := repo.PasswordHash()
+	if err != nil {
+		return err
+	}
+	sessionSecret, err := repo.SessionSecret()
+	if err != nil {
+		return err
+	}
+	if s.trashRetention > 0 {
+		go purgeTrash(repo, s.trashRetention)
+	}
+	if s.undoRetention > 0 {
+		go pruneUndoJournal(repo, s.undoRetention)
+	}
+	if s.backupInterval > 0 {
+		go scheduleBackups(repo, s.backupDir, s.backupInterval, s.backupKeep)
+	}
+
+	handler := &handlers.Handler{
+		Repo:          repo,
+		Password:      s.password,
+		PasswordHash:  passwordHash,
+		SessionSecret: sessionSecret,
+		DailyCapacity: s.dailyCapacity,
+		BackupDir:     s.backupDir,
+		BackupKeep:    s.backupKeep,
+	}
+	fmt.Printf("Server started successfully. Port: %s\n", port)
+	return http.ListenAndServe(":"+port, routes(handler, webDir))
+}
+
+func routes(handler *handlers.Handler, webDir string) http.Handler {
+	for _, method := range handlers.DAVMethods {
+		chi.RegisterMethod(method)
+	}
+	server := chi.NewRouter()
+	server.MethodNotAllowed(handlers.HandleMethodNotAllowed)
+	server.Use(handlers.RequestID)
+	server.Get("/*", http.FileServer(http.Dir(webDir)).ServeHTTP)
+
+	server.Get("/api/nextdate", handlers.HandleNextDate())
+	server.Post("/api/signin", handler.HandleSignIn)
+	server.With(handler.FeedAuth).Get("/api/calendar.ics", handler.HandleCalendarICS)
+	server.Get("/.well-known/caldav", http.RedirectHandler("/caldav/", http.StatusMovedPermanently).ServeHTTP)
+	server.Route("/caldav", func(dav chi.Router) {
+		dav.Options("/*", handlers.HandleDAVOptions)
+		dav.Group(func(dav chi.Router) {
+			dav.Use(handler.DAVAuth)
+			dav.MethodFunc("PROPFIND", "/", handler.HandleDAVPropfind)
+			dav.MethodFunc("PROPFIND", "/tasks/", handler.HandleDAVPropfind)
+			dav.MethodFunc("PROPFIND", "/tasks/{name}", handler.HandleDAVPropfind)
+			dav.MethodFunc("REPORT", "/tasks/", handler.HandleDAVReport)
+			dav.Get("/tasks/{name}", handler.HandleDAVGet)
+			dav.Put("/tasks/{name}", handler.HandleDAVPut)
+			dav.Delete("/tasks/{name}", handler.HandleDAVDelete)
+		})
+	})
+	server.Group(func(api chi.Router) {
+		api.Use(handler.Auth)
+		api.Get("/api/task", handler.HandleTaskGET)
+		api.Post("/api/task", handler.HandleTaskPOST)
+		api.With(handlers.RequireIfMatch).Put("/api/task", handler.HandleTaskPUT)
+		api.With(handlers.RequireIfMatch).Patch("/api/task", handler.HandleTaskPATCH)
+		api.With(handlers.RequireIfMatch).Delete("/api/task", handler.HandleTaskDelete)
+		api.With(handlers.RequireIfMatch).Post("/api/task/done", handler.HandleTaskDone)
+		api.With(handlers.RequireIfMatch).Post("/api/task/status", handler.HandleTaskStatus)
+		api.Post("/api/task/timer/start", handler.HandleTimerStart)
+		api.Post("/api/task/timer/stop", handler.HandleTimerStop)
+		api.Get("/api/task/time", handler.HandleTimeGET)
+		api.Post("/api/task/time", handler.HandleTimePOST)
+		api.Delete("/api/task/time", handler.HandleTimeDelete)
+		api.Get("/api/time", handler.HandleTimeReportGET)
+		api.With(handlers.RequireIfMatch).Post("/api/task/checklist", handler.HandleChecklistPOST)
+		api.With(handlers.RequireIfMatch).Patch("/api/task/checklist", handler.HandleChecklistPATCH)
+		api.With(handlers.RequireIfMatch).Delete("/api/task/checklist", handler.HandleChecklistDelete)
+		api.Get("/api/tasks", handler.HandleTasksGET)
+		api.Get("/api/tags", handler.HandleTagsGET)
+		api.Get("/api/board", handler.HandleBoardGET)
+		api.Get("/api/agenda/load", handler.HandleLoadGET)
+		api.Get("/api/calendar", handler.HandleCalendarGET)
+		api.Get("/api/export", handler.HandleExport)
+		api.Post("/api/import", handler.HandleImport)
+		api.Post("/api/import/ics", handler.HandleICSImport)
+		api.Get("/api/task/history", handler.HandleTaskHistoryGET)
+		api.Get("/api/history", handler.HandleHistoryGET)
+		api.Route("/api/v2/tasks", func(v2 chi.Router) {
+			v2.NotFound(handlers.HandleNotFound)
+			v2.Get("/", handler.HandleTasksGET)
+			v2.Post("/", handler.HandleV2TaskPOST)
+			v2.Get("/{id}", handler.HandleTaskGET)
+			v2.With(handlers.RequireIfMatch).Put("/{id}", handler.HandleV2TaskPUT)
+			v2.With(handlers.RequireIfMatch).Patch("/{id}", handler.HandleTaskPATCH)
+			v2.With(handlers.RequireIfMatch).Delete("/{id}", handler.HandleV2TaskDelete)
+			v2.With(handlers.RequireIfMatch).Post("/{id}/done", handler.HandleV2TaskDone)
+			v2.With(handlers.RequireIfMatch).Post("/{id}/status", handler.HandleTaskStatus)
+			v2.Post("/{id}/timer/start", handler.HandleTimerStart)
+			v2.Post("/{id}/timer/stop", handler.HandleTimerStop)
+			v2.Get("/{id}/time", handler.HandleTimeGET)
+			v2.Post("/{id}/time", handler.HandleTimePOST)
+			v2.Delete("/{id}/time/{entry}", handler.HandleTimeDelete)
+			v2.Get("/{id}/completions", handler.HandleTaskHistoryGET)
+			v2.With(handlers.RequireIfMatch).Post("/{id}/checklist", handler.HandleChecklistPOST)
+			v2.With(handlers.RequireIfMatch).Patch("/{id}/checklist/{item}", handler.HandleChecklistPATCH)
+			v2.With(handlers.RequireIfMatch).Delete("/{id}/checklist/{item}", handler.HandleChecklistDelete)
+		})
+		api.Get("/api/v2/completions", handler.HandleHistoryGET)
+		api.Get("/api/v2/time", handler.HandleTimeReportGET)
+		api.Post("/api/undo", handler.HandleUndo)
+		api.Get("/api/audit", handler.HandleAuditGET)
+		api.Get("/api/trash", handler.HandleTrashGET)
+		api.Post("/api/trash/restore", handler.HandleTrashRestore)
+		api.Delete("/api/trash", handler.HandleTrashPurge)
+		api.Get("/api/v2/trash", handler.HandleTrashGET)
+		api.Post("/api/v2/trash/{id}/restore", handler.HandleTrashRestore)
+		api.Delete("/api/v2/trash/{id}", handler.HandleTrashPurge)
+		api.Get("/api/backups", handler.HandleBackupsGET)
+		api.Post("/api/backups", handler.HandleBackupPOST)
+		api.Get("/api/tokens", handler.HandleTokensGET)
+		api.Post("/api/tokens", handler.HandleTokenPOST)
+		api.Delete("/api/tokens", handler.HandleTokenDelete)
+	})
+	return server
+}
@@ -60,3 +60,45 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 		return "", errors.New("Unsupported repeat rule format: " + repeat)
 	}
 }
+
+// Occurrences возвращает даты задачи в формате 20060102, попадающие в интервал [from, to].
+// Задача без правила повторения встречается только в свою дату.
+func Occurrences(date string, repeat string, from time.Time, to time.Time) ([]string, error) {
+	parsedDate, err := time.Parse("20060102", date)
+	if err != nil {
+		return nil, err
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	var dates []string
+	if repeat == "" {
+		if !parsedDate.Before(from) && !parsedDate.After(to) {
+			dates = append(dates, date)
+		}
+		return dates, nil
+	}
+
+	// первое повторение не раньше начала интервала
+	next := date
+	if parsedDate.Before(from) {
+		if next, err = NextDate(from, date, repeat); err != nil {
+			return nil, err
+		}
+	} else if _, err = NextDate(parsedDate, date, repeat); err != nil {
+		return nil, err
+	}
+	for {
+		current, err := time.Parse("20060102", next)
+		if err != nil {
+			return nil, err
+		}
+		if current.After(to) {
+			return dates, nil
+		}
+		dates = append(dates, next)
+		if next, err = NextDate(current, next, repeat); err != nil {
+			return nil, err
+		}
+	}
+}
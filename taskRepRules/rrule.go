@@ -0,0 +1,171 @@
+package taskRepRules
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// дни недели в порядке правила "w": 1 — понедельник, 7 — воскресенье
+var weekdays = []string{"MO", "TU", "WE", "TH", "FR", "SA", "SU"}
+
+// RRule переводит правило повторения в RRULE из RFC 5545 (без префикса "RRULE:").
+// Кроме поддерживаемых NextDate правил "d" и "y" переводятся и правила
+// "w <дни недели>" и "m <дни месяца> [<месяцы>]".
+func RRule(repeat string) (string, error) {
+	parts := strings.Fields(repeat)
+	if len(parts) == 0 {
+		return "", errors.New("Empty repeat rule")
+	}
+	switch parts[0] {
+	case "d":
+		if len(parts) != 2 {
+			return "", errors.New("Invalid 'd' rule format: " + repeat)
+		}
+		days, err := strconv.Atoi(parts[1])
+		if err != nil || days < 1 || days > 400 {
+			return "", errors.New("Invalid number of days: " + parts[1])
+		}
+		if days == 1 {
+			return "FREQ=DAILY", nil
+		}
+		return "FREQ=DAILY;INTERVAL=" + parts[1], nil
+
+	case "y":
+		if len(parts) != 1 {
+			return "", errors.New("Invalid 'y' rule format: " + repeat)
+		}
+		return "FREQ=YEARLY", nil
+
+	case "w":
+		if len(parts) != 2 {
+			return "", errors.New("Invalid 'w' rule format: " + repeat)
+		}
+		days, err := numbers(parts[1], 1, 7)
+		if err != nil {
+			return "", err
+		}
+		byDay := make([]string, 0, len(days))
+		for _, day := range days {
+			byDay = append(byDay, weekdays[day-1])
+		}
+		return "FREQ=WEEKLY;BYDAY=" + strings.Join(byDay, ","), nil
+
+	case "m":
+		if len(parts) != 2 && len(parts) != 3 {
+			return "", errors.New("Invalid 'm' rule format: " + repeat)
+		}
+		days, err := numbers(parts[1], -2, 31)
+		if err != nil {
+			return "", err
+		}
+		for _, day := range days {
+			if day == 0 {
+				return "", errors.New("Invalid day of month: 0")
+			}
+		}
+		rule := "FREQ=MONTHLY;BYMONTHDAY=" + parts[1]
+		if len(parts) == 3 {
+			if _, err = numbers(parts[2], 1, 12); err != nil {
+				return "", err
+			}
+			rule += ";BYMONTH=" + parts[2]
+		}
+		return rule, nil
+	}
+	return "", errors.New("Unsupported repeat rule format: " + repeat)
+}
+
+// numbers разбирает список чисел через запятую, каждое из которых лежит в [min, max]
+func numbers(list string, min, max int) ([]int, error) {
+	var result []int
+	for _, item := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < min || n > max {
+			return nil, errors.New("Invalid value in repeat rule: " + item)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// FromRRule подбирает к RRULE ближайшее правило, которое понимает NextDate: "d <дней>"
+// с тем же средним интервалом между повторениями или "y". exact сообщает, что правило
+// переведено без потерь. Повторения чаще раза в день перевести нельзя.
+func FromRRule(rule string) (repeat string, exact bool, err error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	parts := map[string]string{}
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return "", false, errors.New("Invalid RRULE part: " + part)
+		}
+		parts[strings.ToUpper(name)] = strings.ToUpper(value)
+	}
+
+	interval := 1
+	if value, ok := parts["INTERVAL"]; ok {
+		if interval, err = strconv.Atoi(value); err != nil || interval < 1 {
+			return "", false, errors.New("Invalid RRULE interval: " + value)
+		}
+	}
+	// число повторений за период, например BYDAY=MO,WE,FR — три раза в неделю
+	count := func(name string) int {
+		if parts[name] == "" {
+			return 1
+		}
+		return len(strings.Split(parts[name], ","))
+	}
+	// ограничения кроме интервала теряются при переводе
+	exact = true
+	for name := range parts {
+		switch name {
+		case "FREQ", "INTERVAL", "WKST":
+		case "BYDAY":
+			exact = exact && parts["FREQ"] == "WEEKLY" && count("BYDAY") == 1
+		case "BYMONTHDAY":
+			exact = exact && parts["FREQ"] == "YEARLY" && count("BYMONTHDAY") == 1
+		case "BYMONTH":
+			exact = exact && parts["FREQ"] == "YEARLY" && count("BYMONTH") == 1
+		default:
+			exact = false
+		}
+	}
+
+	var days float64
+	switch parts["FREQ"] {
+	case "DAILY":
+		days = float64(interval)
+	case "WEEKLY":
+		days = float64(7*interval) / float64(count("BYDAY"))
+	case "MONTHLY":
+		days = float64(30*interval) / float64(count("BYMONTHDAY"))
+		exact = false
+	case "YEARLY":
+		if interval == 1 && count("BYMONTH") == 1 && count("BYMONTHDAY") == 1 {
+			return "y", exact, nil
+		}
+		// повторения раз в несколько лет не помещаются в "d", ближайшее — "y"
+		days = float64(365*interval) / float64(count("BYMONTH")*count("BYMONTHDAY"))
+		if days > 400 {
+			return "y", false, nil
+		}
+		exact = false
+	case "HOURLY", "MINUTELY", "SECONDLY":
+		return "", false, errors.New("Repeating more often than daily is not supported: " + rule)
+	default:
+		return "", false, errors.New("Unsupported RRULE frequency: " + parts["FREQ"])
+	}
+
+	n := int(days + 0.5)
+	if n < 1 {
+		n = 1
+	}
+	if n > 400 {
+		return "", false, errors.New("The RRULE interval exceeds 400 days: " + rule)
+	}
+	if float64(n) != days {
+		exact = false
+	}
+	return "d " + strconv.Itoa(n), exact, nil
+}
@@ -33,6 +33,8 @@ func requestJSON(apipath string, values map[string]any, method string) ([]byte,
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	// Changes overwrite any version; TestETags covers If-Match.
+	req.Header.Set("If-Match", "*")
 
 	client := &http.Client{}
 	if len(Token) > 0 {
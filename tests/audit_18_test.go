@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditEntry struct {
+	TaskID    string         `json:"task_id"`
+	Operation string         `json:"operation"`
+	Actor     string         `json:"actor"`
+	RequestID string         `json:"request_id"`
+	Before    map[string]any `json:"before"`
+	After     map[string]any `json:"after"`
+}
+
+func getAudit(t *testing.T, query string) []auditEntry {
+	body, err := requestJSON("api/audit?"+query, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string][]auditEntry
+	assert.NoError(t, json.Unmarshal(body, &m), string(body))
+	return m["entries"]
+}
+
+func TestAuditLog(t *testing.T) {
+	resp, body, err := requestWithHeaders("api/task", http.MethodPost, `{"title":"Аудит","comment":"было"}`,
+		map[string]string{"X-Request-ID": "audit-create"})
+	assert.NoError(t, err)
+	assert.Equal(t, "audit-create", resp.Header.Get("X-Request-ID"))
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	id := fmt.Sprint(m["id"])
+
+	_, _, err = requestWithHeaders("api/task?id="+id, http.MethodPatch, `{"comment":"стало"}`,
+		map[string]string{"X-Request-ID": "audit-patch", "If-Match": "*"})
+	assert.NoError(t, err)
+	_, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+
+	entries := getAudit(t, "task_id="+id)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "delete", entries[0].Operation)
+	assert.Nil(t, entries[0].Before["deleted_at"])
+	assert.NotEmpty(t, entries[0].After["deleted_at"])
+
+	assert.Equal(t, "update", entries[1].Operation)
+	assert.Equal(t, "audit-patch", entries[1].RequestID)
+	assert.Equal(t, "anonymous", entries[1].Actor)
+	assert.Equal(t, map[string]any{"comment": "было"}, entries[1].Before)
+	assert.Equal(t, map[string]any{"comment": "стало"}, entries[1].After)
+
+	assert.Equal(t, "insert", entries[2].Operation)
+	assert.Equal(t, "audit-create", entries[2].RequestID)
+	assert.Nil(t, entries[2].Before)
+	assert.Equal(t, "Аудит", entries[2].After["title"])
+
+	assert.Empty(t, getAudit(t, "task_id="+id+"&actor=someone"))
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(`20060102`)
+	assert.Empty(t, getAudit(t, "task_id="+id+"&from="+tomorrow))
+	assert.Len(t, getAudit(t, "task_id="+id+"&limit=2"), 2)
+
+	// Two tokens with the same name are told apart by their IDs.
+	m, err = postJSON("api/task", map[string]any{"title": "Аудит токенов"}, http.MethodPost)
+	assert.NoError(t, err)
+	id = fmt.Sprint(m["id"])
+	defer postJSON("api/task?id="+id, nil, http.MethodDelete)
+	var actors []string
+	for i := 0; i < 2; i++ {
+		m, err := postJSON("api/tokens", map[string]any{"name": "ci", "scopes": []string{"write"}}, http.MethodPost)
+		assert.NoError(t, err)
+		tokenID := fmt.Sprint(m["id"])
+		defer requestWithToken("api/tokens?id="+tokenID, http.MethodDelete, "", "")
+		status, _, err := requestWithToken("api/task?id="+id, http.MethodPatch, fmt.Sprint(m["token"]), `{"comment":"токен"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		actors = append(actors, "token:"+tokenID+":ci")
+	}
+	for _, actor := range actors {
+		entries = getAudit(t, "task_id="+id+"&actor="+url.QueryEscape(actor))
+		assert.Len(t, entries, 1, actor)
+	}
+
+	status, _, err := requestWithToken("api/audit?from=yesterday", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	status, body, err := requestWithToken("api/backups", http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status, string(body))
+	var created struct {
+		File    string   `json:"file"`
+		Size    int64    `json:"size"`
+		Removed []string `json:"removed"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &created))
+	assert.Regexp(t, regexp.MustCompile(`^scheduler-\d{8}-\d{6}\.\d{3}\.db$`), created.File)
+	assert.Positive(t, created.Size)
+	assert.NotContains(t, created.Removed, created.File)
+
+	status, body, err = requestWithToken("api/backups", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	var list struct {
+		Backups []struct {
+			File string `json:"file"`
+			Size int64  `json:"size"`
+		} `json:"backups"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &list))
+	if assert.NotEmpty(t, list.Backups) {
+		// The newest backup comes first.
+		assert.Equal(t, created.File, list.Backups[0].File)
+		assert.Equal(t, created.Size, list.Backups[0].Size)
+	}
+
+	// Backups are administration: API tokens, even with the write scope, cannot use them.
+	m, err := postJSON("api/tokens", map[string]any{"name": "backups", "scopes": []string{"read", "write"}}, http.MethodPost)
+	assert.NoError(t, err)
+	defer requestWithToken("api/tokens?id="+fmt.Sprint(m["id"]), http.MethodDelete, "", "")
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		status, _, err = requestWithToken("api/backups", method, fmt.Sprint(m["token"]), "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, status, method)
+	}
+}
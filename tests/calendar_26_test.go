@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type calendarDay struct {
+	Date  string `json:"date"`
+	Tasks []struct {
+		ID      string `json:"id"`
+		Date    string `json:"date"`
+		Status  string `json:"status"`
+		Virtual bool   `json:"virtual"`
+	} `json:"tasks"`
+}
+
+func TestCalendar(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	var ids []string
+	defer func() {
+		for _, id := range ids {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+	for _, task := range []map[string]any{
+		{"date": "20990601", "title": "Планёрка", "repeat": "d 7"},
+		{"date": "20990610", "title": "Сдать декларацию"},
+		{"date": "20990612", "title": "Удалённая задача"},
+	} {
+		ret, err := postJSON("api/task", task, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["id"], ret)
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+	weekly, oneOff, deleted := ids[0], ids[1], ids[2]
+	status, _, err := requestWithToken("api/task/status?id="+oneOff, http.MethodPost, "", `{"status":"done"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/task?id="+deleted, http.MethodDelete, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body, err := requestWithToken("api/calendar?from=20990601&to=20990630", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	var calendar struct {
+		From string        `json:"from"`
+		To   string        `json:"to"`
+		Days []calendarDay `json:"days"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &calendar))
+	assert.Equal(t, "20990601", calendar.From)
+	assert.Len(t, calendar.Days, 30)
+
+	found := map[string][]string{}
+	for _, day := range calendar.Days {
+		for _, task := range day.Tasks {
+			found[task.ID] = append(found[task.ID], day.Date)
+			if task.ID == weekly {
+				assert.Equal(t, "20990601", task.Date)
+				assert.Equal(t, day.Date != "20990601", task.Virtual, day.Date)
+			}
+			if task.ID == oneOff {
+				assert.Equal(t, "done", task.Status)
+				assert.False(t, task.Virtual)
+			}
+		}
+	}
+	assert.Equal(t, []string{"20990601", "20990608", "20990615", "20990622", "20990629"}, found[weekly])
+	assert.Equal(t, []string{"20990610"}, found[oneOff])
+	assert.Empty(t, found[deleted])
+
+	// A range starting after the stored date still finds the repetitions.
+	status, body, err = requestWithToken("api/calendar?from=20990620&to=20990626", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(body, &calendar))
+	assert.Len(t, calendar.Days, 7)
+	var weeklyDays []string
+	for _, day := range calendar.Days {
+		for _, task := range day.Tasks {
+			if task.ID == weekly {
+				weeklyDays = append(weeklyDays, day.Date)
+			}
+		}
+	}
+	assert.Equal(t, []string{"20990622"}, weeklyDays)
+
+	status, _, err = requestWithToken("api/calendar?from=20990601&to=20990501", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type checklistTask struct {
+	ID        string `json:"id"`
+	Date      string `json:"date"`
+	Checklist []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+		Done  bool   `json:"done"`
+	} `json:"checklist"`
+}
+
+func getChecklistTask(t *testing.T, id string) checklistTask {
+	status, body, err := requestWithToken("api/task?id="+id, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var task checklistTask
+	assert.NoError(t, json.Unmarshal(body, &task))
+	return task
+}
+
+func TestChecklist(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	today := time.Now().Format(`20060102`)
+
+	ret, err := postJSON("api/task", map[string]any{
+		"title":     "Подготовить релиз",
+		"date":      today,
+		"repeat":    "d 7",
+		"checklist": []map[string]any{{"title": "Обновить changelog"}, {"title": "Собрать сборку", "done": true}},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	id := fmt.Sprint(ret["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+
+	task := getChecklistTask(t, id)
+	assert.Len(t, task.Checklist, 2)
+	assert.Equal(t, "Обновить changelog", task.Checklist[0].Title)
+	assert.True(t, task.Checklist[1].Done)
+
+	status, _, err := requestWithToken("api/task/checklist?id="+id, http.MethodPost, "", `{"title":"Разослать письмо"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	task = getChecklistTask(t, id)
+	assert.Len(t, task.Checklist, 3)
+	first := task.Checklist[0].ID
+
+	status, _, err = requestWithToken("api/task/checklist?id="+id+"&item="+first, http.MethodPatch, "", `{"done":true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	task = getChecklistTask(t, id)
+	assert.True(t, task.Checklist[0].Done)
+	assert.Equal(t, "Обновить changelog", task.Checklist[0].Title)
+
+	// Rescheduling a recurring task unticks its checklist, undo brings the ticks back.
+	token := undoToken(t, "api/task/done?id="+id, http.MethodPost, "")
+	task = getChecklistTask(t, id)
+	assert.NotEqual(t, today, task.Date)
+	assert.Len(t, task.Checklist, 3)
+	for _, item := range task.Checklist {
+		assert.False(t, item.Done, item.Title)
+	}
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusOK, status)
+	task = getChecklistTask(t, id)
+	assert.Equal(t, today, task.Date)
+	assert.True(t, task.Checklist[0].Done)
+	assert.True(t, task.Checklist[1].Done)
+	assert.False(t, task.Checklist[2].Done)
+
+	resp, _, err := requestWithHeaders("api/v2/tasks/"+id+"/checklist/"+first, http.MethodDelete, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _, err = requestWithHeaders("api/v2/tasks/"+id+"/checklist/"+first, http.MethodDelete, "",
+		map[string]string{"If-Match": "*"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, getChecklistTask(t, id).Checklist, 2)
+
+	// A full update keeps the IDs of the items it sends and adds the items without one.
+	task = getChecklistTask(t, id)
+	kept := task.Checklist[1].ID
+	status, body, err := requestWithToken("api/v2/tasks/"+id, http.MethodPut, "", fmt.Sprintf(
+		`{"title":"Подготовить релиз","date":%q,"repeat":"d 7","checklist":[{"id":%q,"title":"Разослать письма","done":true},{"title":"Закрыть задачи"}]}`,
+		task.Date, kept))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	task = getChecklistTask(t, id)
+	assert.Len(t, task.Checklist, 2)
+	assert.Equal(t, kept, task.Checklist[0].ID)
+	assert.Equal(t, "Разослать письма", task.Checklist[0].Title)
+	assert.True(t, task.Checklist[0].Done)
+	assert.Equal(t, "Закрыть задачи", task.Checklist[1].Title)
+	status, _, err = requestWithToken("api/task/checklist?id="+id+"&item="+kept, http.MethodPatch, "", `{"done":false}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _, err = requestWithToken("api/task/checklist?id="+id+"&item="+first, http.MethodPatch, "", `{"done":false}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _, err = requestWithToken("api/task/checklist?id="+id, http.MethodPost, "", `{"title":""}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _, err = requestWithToken("api/task/checklist?id="+id, http.MethodPatch, "", `{"done":true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Completing a one-off task removes it together with its checklist.
+	ret, err = postJSON("api/task", map[string]any{
+		"title":     "Разовая с чеклистом",
+		"checklist": []map[string]any{{"title": "Пункт"}},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	oneOff := fmt.Sprint(ret["id"])
+	status, _, err = requestWithToken("api/task/done?id="+oneOff, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var items int
+	assert.NoError(t, db.Get(&items, `SELECT count(*) FROM checklist_items WHERE task_id = ?`, oneOff))
+	assert.Equal(t, 0, items)
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "scheduler")
+	build, err := exec.Command("go", "build", "-o", bin, "..").CombinedOutput()
+	require.NoError(t, err, string(build))
+	dbFile := filepath.Join(dir, "cli.db")
+
+	run := func(stdin string, args ...string) (string, error) {
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(os.Environ(), "TODO_DBFILE="+dbFile, "TODO_BACKUP_DIR="+filepath.Join(dir, "backups"))
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := run("", "check", "-web", "../web")
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "does not exist yet")
+	out, err = run("", "migrate")
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "migrations applied")
+	out, err = run("", "check", "-web", "../web", "-port", "0")
+	assert.Error(t, err)
+	assert.Contains(t, out, "FAIL port")
+
+	file := filepath.Join(dir, "tasks.csv")
+	assert.NoError(t, os.WriteFile(file, []byte("title,date,tags\r\nПолить цветы,20990805,\"дом,сад\"\r\n,20990805,\r\n"), 0o644))
+	out, err = run("", "import", "-dry-run", file)
+	assert.Error(t, err)
+	assert.Contains(t, out, "Would import 1 tasks, skipped 0, failed 1")
+	assert.NoError(t, os.WriteFile(file, []byte("title,date,tags\r\nПолить цветы,20990805,\"дом,сад\"\r\n"), 0o644))
+	out, err = run("", "import", file)
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "Imported 1 tasks")
+
+	out, err = run("", "export", "-format", "csv")
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, `Полить цветы,,,0,0,todo,"дом,сад",`)
+
+	out, err = run("", "backup")
+	assert.NoError(t, err, out)
+	backup := strings.TrimPrefix(strings.TrimSpace(out), "Database backed up to ")
+	assert.FileExists(t, backup)
+
+	out, err = run("новый пароль\n", "reset-password")
+	assert.NoError(t, err, out)
+	db, err := sqlx.Connect("sqlite3", dbFile)
+	require.NoError(t, err)
+	var hash string
+	assert.NoError(t, db.Get(&hash, `SELECT value FROM settings WHERE key = 'password_hash'`))
+	assert.True(t, strings.HasPrefix(hash, "pbkdf2-sha256$"), hash)
+	assert.NotContains(t, hash, "новый пароль")
+	var secret, rotated string
+	assert.NoError(t, db.Get(&secret, `SELECT value FROM settings WHERE key = 'session_secret'`))
+	assert.NotEmpty(t, secret)
+	out, err = run("\n", "reset-password")
+	assert.Error(t, err, out)
+	out, err = run("", "reset-password", "-clear")
+	assert.NoError(t, err, out)
+	assert.NoError(t, db.Get(&rotated, `SELECT value FROM settings WHERE key = 'session_secret'`))
+	assert.NotEqual(t, secret, rotated)
+	var hashes int
+	assert.NoError(t, db.Get(&hashes, `SELECT COUNT(*) FROM settings WHERE key = 'password_hash'`))
+	assert.Zero(t, hashes)
+	_, err = db.Exec(`DELETE FROM scheduler`)
+	assert.NoError(t, err)
+	db.Close()
+
+	out, err = run("", "restore", file)
+	assert.Error(t, err, out)
+	out, err = run("", "restore", backup)
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "The current database is backed up")
+	out, err = run("", "export")
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "Полить цветы")
+
+	out, err = run("", "unknown")
+	assert.Error(t, err)
+	assert.Contains(t, out, "unknown command")
+
+	// '?' and '#' are part of the file name, not the start of connection parameters.
+	dbFile = filepath.Join(dir, "tasks?#1.db")
+	out, err = run("", "migrate")
+	assert.NoError(t, err, out)
+	assert.FileExists(t, dbFile)
+	assert.NoFileExists(t, filepath.Join(dir, "tasks"))
+	copied := filepath.Join(dir, "copy?#2.db")
+	data, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(copied, data, 0o644))
+	out, err = run("", "restore", copied)
+	assert.NoError(t, err, out)
+	out, err = run("", "export")
+	assert.NoError(t, err, out)
+	assert.Contains(t, out, "Полить цветы")
+}
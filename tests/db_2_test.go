@@ -11,11 +11,16 @@ import (
 )
 
 type Task struct {
-	ID      int64  `db:"id"`
-	Date    string `db:"date"`
-	Title   string `db:"title"`
-	Comment string `db:"comment"`
-	Repeat  string `db:"repeat"`
+	ID        int64   `db:"id"`
+	Date      string  `db:"date"`
+	Title     string  `db:"title"`
+	Comment   string  `db:"comment"`
+	Repeat    string  `db:"repeat"`
+	Version   int64   `db:"version"`
+	DeletedAt *string `db:"deleted_at"`
+	Priority  int64   `db:"priority"`
+	Estimate  int64   `db:"estimate"`
+	Status    string  `db:"status"`
 }
 
 func count(db *sqlx.DB) (int, error) {
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type dependentTask struct {
+	ID        string   `json:"id"`
+	DependsOn []string `json:"depends_on"`
+	Blockers  []string `json:"blockers"`
+	Blocked   bool     `json:"blocked"`
+}
+
+func getDependentTask(t *testing.T, id string) dependentTask {
+	status, body, err := requestWithToken("api/task?id="+id, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var task dependentTask
+	assert.NoError(t, json.Unmarshal(body, &task))
+	return task
+}
+
+func TestDependencies(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	add := func(title, repeat string, dependsOn ...string) string {
+		ret, err := postJSON("api/task", map[string]any{"title": title, "repeat": repeat, "depends_on": dependsOn}, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotNil(t, ret["id"], ret)
+		return fmt.Sprint(ret["id"])
+	}
+	migration := add("Выполнить миграцию", "")
+	deploy := add("Выкатить релиз", "", migration)
+	backup := add("Сделать бэкап", "d 1")
+	report := add("Отчёт после бэкапа", "", backup)
+	// Dependent tasks carry a boolean that the legacy tests cannot decode as a string.
+	defer func() {
+		for _, id := range []string{migration, deploy, backup, report} {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+
+	task := getDependentTask(t, deploy)
+	assert.True(t, task.Blocked)
+	assert.Equal(t, []string{migration}, task.Blockers)
+	assert.Equal(t, []string{migration}, task.DependsOn)
+	assert.False(t, getDependentTask(t, migration).Blocked)
+
+	status, body, err := requestWithToken("api/tasks?limit=500&sort=created&order=desc", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var list struct {
+		Tasks []dependentTask `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &list))
+	blocked := map[string]bool{}
+	for _, task := range list.Tasks {
+		blocked[task.ID] = task.Blocked
+	}
+	assert.True(t, blocked[deploy])
+	assert.False(t, blocked[migration])
+
+	// Cycles and unknown prerequisites are rejected.
+	for _, patch := range []string{`{"depends_on":["` + deploy + `"]}`, `{"depends_on":["` + migration + `"]}`, `{"depends_on":["987654321"]}`, `{"depends_on":["abc"]}`} {
+		status, _, err = requestWithToken("api/task?id="+migration, http.MethodPatch, "", patch)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, patch)
+	}
+
+	status, body, err = requestWithToken("api/task/done?id="+deploy, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, status, string(body))
+
+	status, _, err = requestWithToken("api/task/done?id="+migration, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, getDependentTask(t, deploy).Blocked)
+	status, _, err = requestWithToken("api/task/done?id="+deploy, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	// A recurring prerequisite stops blocking once it has been completed.
+	assert.True(t, getDependentTask(t, report).Blocked)
+	status, _, err = requestWithToken("api/task/done?id="+backup, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, getDependentTask(t, report).Blocked)
+
+	// Forcing completes a blocked task.
+	blockedTask := add("Заблокированная", "")
+	assert.False(t, getDependentTask(t, blockedTask).Blocked)
+	status, _, err = requestWithToken("api/task?id="+blockedTask, http.MethodPatch, "", `{"depends_on":["`+report+`"]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{report}, getDependentTask(t, blockedTask).Blockers)
+	status, _, err = requestWithToken("api/task/done?"+url.Values{"id": {blockedTask}, "force": {"true"}}.Encode(), http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	notFoundTask(t, blockedTask)
+}
+
+func TestDependencyUndoCycle(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	var ids []string
+	for _, title := range []string{"Первая", "Вторая"} {
+		ret, err := postJSON("api/task", map[string]any{"title": title}, http.MethodPost)
+		assert.NoError(t, err)
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+	first, second := ids[0], ids[1]
+	defer func() {
+		for _, id := range ids {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+
+	undoToken(t, "api/task?id="+first, http.MethodPatch, `{"depends_on":["`+second+`"]}`)
+	token := undoToken(t, "api/task?id="+first, http.MethodPatch, `{"depends_on":[]}`)
+	undoToken(t, "api/task?id="+second, http.MethodPatch, `{"depends_on":["`+first+`"]}`)
+
+	// Bringing back the first dependency would close a cycle.
+	status, _ := undo(t, token)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Empty(t, getDependentTask(t, first).DependsOn)
+	assert.Equal(t, []string{first}, getDependentTask(t, second).DependsOn)
+}
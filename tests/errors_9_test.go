@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type apiError struct {
+	status int
+	path   string
+	method string
+	body   string
+	code   string
+	field  string
+}
+
+func TestErrorSchema(t *testing.T) {
+	tbl := []apiError{
+		{http.StatusNotFound, "api/task?id=987654321", http.MethodGet, "", "not_found", ""},
+		{http.StatusNotFound, "api/task?id=987654321", http.MethodDelete, "", "not_found", ""},
+		{http.StatusNotFound, "api/task/done?id=987654321", http.MethodPost, "", "not_found", ""},
+		{http.StatusBadRequest, "api/task?id=abc", http.MethodGet, "", "validation_error", "id"},
+		{http.StatusBadRequest, "api/task", http.MethodPost, `{"date":"20240126"}`, "validation_error", "title"},
+		{http.StatusBadRequest, "api/task", http.MethodPost, `{"title":"Тест","repeat":"ooops"}`, "validation_error", "repeat"},
+		{http.StatusBadRequest, "api/task", http.MethodPut, `{"id":"abc","title":"Тест"}`, "validation_error", "id"},
+		{http.StatusNotFound, "api/task", http.MethodPut, `{"id":"987654321","title":"Тест"}`, "not_found", ""},
+		{http.StatusBadRequest, "api/nextdate?now=20240126&date=20240126&repeat=k", http.MethodGet, "", "validation_error", "repeat"},
+		{http.StatusMethodNotAllowed, "api/tasks", http.MethodPatch, "", "method_not_allowed", ""},
+	}
+	for _, v := range tbl {
+		status, body, err := requestWithToken(v.path, v.method, "", v.body)
+		assert.NoError(t, err)
+		assert.Equal(t, v.status, status, "%s %s", v.method, v.path)
+
+		var m map[string]string
+		assert.NoError(t, json.Unmarshal(body, &m), "%s %s", v.method, v.path)
+		assert.NotEmpty(t, m["error"])
+		assert.Equal(t, v.code, m["code"], "%s %s", v.method, v.path)
+		assert.Equal(t, v.field, m["field"], "%s %s", v.method, v.path)
+	}
+}
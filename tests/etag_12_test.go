@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETags(t *testing.T) {
+	now := time.Now().Format(`20060102`)
+	id := addTask(t, task{
+		date:  now,
+		title: "Общая задача",
+	})
+
+	resp, _, err := requestWithHeaders("api/task?id="+id, http.MethodGet, "", nil)
+	assert.NoError(t, err)
+	first := resp.Header.Get("ETag")
+	assert.Equal(t, `"1"`, first)
+
+	update := `{"id":"` + id + `","date":"` + now + `","title":"Правка первого"}`
+	resp, _, err = requestWithHeaders("api/task", http.MethodPut, update, map[string]string{"If-Match": first})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	// The list carries the ETags of its tasks for the web UI.
+	listed := ""
+	for _, task := range getAllPages(t, url.Values{"limit": {"500"}}) {
+		if task["id"] == id {
+			listed = task["etag"]
+		}
+	}
+	assert.Equal(t, `"2"`, listed)
+
+	update = `{"id":"` + id + `","date":"` + now + `","title":"Правка второго"}`
+	resp, body, err := requestWithHeaders("api/task", http.MethodPut, update, map[string]string{"If-Match": first})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Contains(t, string(body), "precondition_failed")
+
+	resp, _, err = requestWithHeaders("api/task/done?id="+id, http.MethodPost, "", map[string]string{"If-Match": first})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _, err = requestWithHeaders("api/task?id="+id, http.MethodDelete, "", map[string]string{"If-Match": first})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	for _, path := range []string{"api/v2/tasks/" + id, "api/task?id=" + id} {
+		resp, _, err = requestWithHeaders(path, http.MethodDelete, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	}
+	resp, _, err = requestWithHeaders("api/task", http.MethodPut, update, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp, _, err = requestWithHeaders("api/task/done?id="+id, http.MethodPost, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, _, err = requestWithHeaders("api/v2/tasks/"+id, http.MethodDelete, "", map[string]string{"If-Match": `"2"`})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
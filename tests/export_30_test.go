@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	first, err := postJSON("api/task", map[string]any{"date": "20990701", "title": "Собрать вещи " + suffix,
+		"tags": []string{"отпуск"}, "priority": 2}, http.MethodPost)
+	assert.NoError(t, err)
+	firstID := fmt.Sprint(first["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, firstID)
+	second, err := postJSON("api/task", map[string]any{"date": "20990702", "title": "Уехать, наконец " + suffix,
+		"depends_on": []string{firstID}}, http.MethodPost)
+	assert.NoError(t, err)
+	secondID := fmt.Sprint(second["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, secondID)
+
+	resp, body, err := requestWithHeaders("api/export", http.MethodGet, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), ".json")
+	var export struct {
+		ExportedAt  string           `json:"exported_at"`
+		Tasks       []map[string]any `json:"tasks"`
+		Completions []map[string]any `json:"completions"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &export), string(body))
+	assert.NotEmpty(t, export.ExportedAt)
+	assert.NotNil(t, export.Completions)
+	exported := map[string]map[string]any{}
+	for _, task := range export.Tasks {
+		exported[fmt.Sprint(task["id"])] = task
+	}
+	assert.Equal(t, []any{"отпуск"}, exported[firstID]["tags"])
+	assert.EqualValues(t, 2, exported[firstID]["priority"])
+	assert.Equal(t, []any{firstID}, exported[secondID]["depends_on"])
+
+	resp, body, err = requestWithHeaders("api/export?format=csv", http.MethodGet, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/csv")
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "date", "title", "comment", "repeat", "priority", "estimate", "status", "tags", "depends_on"}, records[0])
+	var found bool
+	for _, record := range records[1:] {
+		if record[0] == secondID {
+			found = true
+			assert.Equal(t, "Уехать, наконец "+suffix, record[2])
+			assert.Equal(t, firstID, record[9])
+		}
+	}
+	assert.True(t, found)
+
+	status, body, err := requestWithToken("api/export?format=xml", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status, string(body))
+}
+
+func TestImport(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	existing, err := postJSON("api/task", map[string]any{"date": "20990801", "title": "Уже есть " + suffix}, http.MethodPost)
+	assert.NoError(t, err)
+	existingID := fmt.Sprint(existing["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, existingID)
+
+	file, err := json.Marshal(map[string]any{"tasks": []map[string]any{
+		{"id": "1", "date": "20990801", "title": "Уже есть " + suffix},
+		{"id": "2", "date": "20990802", "title": "Купить билеты " + suffix, "tags": []string{"отпуск"},
+			"checklist": []map[string]any{{"id": "77", "title": "Поезд", "done": true}}},
+		{"id": "3", "date": "20990803", "title": "Забронировать отель " + suffix, "depends_on": []string{"2", "1", "99"}},
+		{"id": "4", "date": "20990802", "title": "Купить билеты " + suffix},
+		{"id": "5", "date": "20990803", "title": ""},
+		{"id": "6", "date": "20990803", "title": "Плохое правило " + suffix, "repeat": "x 1"},
+		{"id": "7", "title": "Неверный приоритет " + suffix, "priority": "high"},
+	}})
+	assert.NoError(t, err)
+
+	var dryRun importResult
+	status, body, err := requestWithToken("api/import?dry_run=true", http.MethodPost, "", string(file))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	assert.NoError(t, json.Unmarshal(body, &dryRun))
+	assert.Contains(t, string(body), `"dry_run":true`)
+	assert.Equal(t, 2, dryRun.Imported)
+	assert.Equal(t, 2, dryRun.Skipped)
+	assert.Equal(t, 3, dryRun.Failed)
+	var count int
+	assert.NoError(t, db.Get(&count, `SELECT count(*) FROM scheduler WHERE title LIKE ?`, "%"+suffix))
+	assert.Equal(t, 1, count)
+
+	var result importResult
+	status, body, err = requestWithToken("api/import", http.MethodPost, "", string(file))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	assert.NoError(t, json.Unmarshal(body, &result))
+	defer func() {
+		for _, item := range result.Items {
+			if item.ID != "" {
+				db.Exec(`DELETE FROM scheduler WHERE id = ?`, item.ID)
+			}
+		}
+	}()
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 3, result.Failed)
+	if !assert.Len(t, result.Items, 7) {
+		return
+	}
+	statuses := []string{}
+	for _, item := range result.Items {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []string{"skipped", "imported", "imported", "skipped", "failed", "failed", "failed"}, statuses)
+	assert.Contains(t, result.Items[0].Warning, existingID)
+	assert.Equal(t, "title", result.Items[4].Field)
+	assert.Equal(t, "repeat", result.Items[5].Field)
+
+	tickets, hotel := result.Items[1].ID, result.Items[2].ID
+	assert.Equal(t, []string{"отпуск"}, getTaskTags(t, tickets))
+	ret, err := postJSON("api/task?id="+tickets, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Len(t, ret["checklist"], 1)
+	// The prerequisites point to the new and the duplicate task; 99 is not in the file.
+	ret, err = postJSON("api/task?id="+hotel, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []any{tickets, existingID}, ret["depends_on"])
+	assert.Contains(t, result.Items[2].Warning, "99")
+
+	csvFile := "title,date,tags,priority\r\n" +
+		"Полить цветы " + suffix + ",20990805,\"дом,сад\",1\r\n" +
+		"Без приоритета " + suffix + ",20990805,,высокий\r\n"
+	var csvResult importResult
+	resp, body, err := requestWithHeaders("api/import", http.MethodPost, csvFile, map[string]string{"Content-Type": "text/csv"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.NoError(t, json.Unmarshal(body, &csvResult))
+	defer func() {
+		for _, item := range csvResult.Items {
+			if item.ID != "" {
+				db.Exec(`DELETE FROM scheduler WHERE id = ?`, item.ID)
+			}
+		}
+	}()
+	assert.Equal(t, 1, csvResult.Imported)
+	assert.Equal(t, 1, csvResult.Failed)
+	assert.Equal(t, []string{"дом", "сад"}, getTaskTags(t, csvResult.Items[0].ID))
+	assert.Equal(t, "priority", csvResult.Items[1].Field)
+
+	status, body, err = requestWithToken("api/import?format=csv", http.MethodPost, "", "date\r\n20990101\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status, string(body))
+}
+
+func TestImportDoneTask(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	ret, err := postJSON("api/task", map[string]any{"date": "20990901", "title": "Сдать отчёт " + suffix}, http.MethodPost)
+	assert.NoError(t, err)
+	id := fmt.Sprint(ret["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+	status, body, err := requestWithToken("api/task/status?id="+id, http.MethodPost, "", `{"status":"done"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+
+	exports := map[string]string{}
+	for _, format := range []string{"json", "csv"} {
+		status, body, err = requestWithToken("api/export?format="+format, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		exports[format] = string(body)
+	}
+	var export struct {
+		Tasks []map[string]any `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(exports["json"]), &export))
+	var row map[string]any
+	for _, task := range export.Tasks {
+		if task["id"] == id {
+			row = task
+		}
+	}
+	assert.Equal(t, "done", row["status"])
+	records, err := csv.NewReader(strings.NewReader(exports["csv"])).ReadAll()
+	assert.NoError(t, err)
+	var record []string
+	for _, r := range records[1:] {
+		if r[0] == id {
+			record = r
+		}
+	}
+	require.NotNil(t, record)
+	jsonFile, err := json.Marshal(map[string]any{"tasks": []any{row}})
+	assert.NoError(t, err)
+	var csvFile strings.Builder
+	writer := csv.NewWriter(&csvFile)
+	writer.WriteAll([][]string{records[0], record})
+
+	// The original task is removed, so that the rows are not skipped as duplicates.
+	_, err = db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+	assert.NoError(t, err)
+	for format, file := range map[string]string{"json": string(jsonFile), "csv": csvFile.String()} {
+		for _, dryRun := range []bool{true, false} {
+			var result importResult
+			status, body, err = requestWithToken(fmt.Sprintf("api/import?format=%s&dry_run=%t", format, dryRun), http.MethodPost, "", file)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, status, string(body))
+			assert.NoError(t, json.Unmarshal(body, &result))
+			assert.Equal(t, 1, result.Imported, format+": "+string(body))
+			assert.Equal(t, 0, result.Failed, format+": "+string(body))
+			if dryRun || len(result.Items) == 0 {
+				continue
+			}
+			var task Task
+			assert.NoError(t, db.Get(&task, `SELECT * FROM scheduler WHERE id = ?`, result.Items[0].ID))
+			assert.Equal(t, "done", task.Status, format)
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, result.Items[0].ID)
+		}
+	}
+
+	// A dry run makes the checks of the repository too.
+	var result importResult
+	status, body, err = requestWithToken("api/import?dry_run=true", http.MethodPost, "",
+		`[{"date":"20990901","title":"Неизвестный статус `+suffix+`","status":"archived"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, 1, result.Failed, string(body))
+	if assert.Len(t, result.Items, 1) {
+		assert.Equal(t, "status", result.Items[0].Field)
+	}
+}
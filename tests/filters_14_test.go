@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTasksFilters(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	insert := func(date time.Time, repeat string) string {
+		res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, 'Фильтр', '', ?)`,
+			date.Format(`20060102`), repeat)
+		assert.NoError(t, err)
+		id, err := res.LastInsertId()
+		assert.NoError(t, err)
+		return fmt.Sprint(id)
+	}
+	overdue := insert(now.AddDate(0, 0, -3), "")
+	today := insert(now, "d 2")
+	later := insert(now.AddDate(0, 0, 8), "")
+
+	ids := func(params url.Values) map[string]bool {
+		params.Set("limit", "500")
+		found := map[string]bool{}
+		for _, v := range getAllPages(t, params) {
+			found[v["id"]] = true
+		}
+		return found
+	}
+
+	got := ids(url.Values{"due": {"overdue"}})
+	assert.True(t, got[overdue])
+	assert.False(t, got[today])
+	assert.False(t, got[later])
+
+	got = ids(url.Values{"due": {"today"}})
+	assert.False(t, got[overdue])
+	assert.True(t, got[today])
+
+	got = ids(url.Values{"due": {"week"}})
+	assert.True(t, got[today])
+	assert.False(t, got[later])
+
+	got = ids(url.Values{"from": {now.AddDate(0, 0, -1).Format(`20060102`)}, "to": {now.AddDate(0, 0, 10).Format(`20060102`)}})
+	assert.False(t, got[overdue])
+	assert.True(t, got[today])
+	assert.True(t, got[later])
+
+	got = ids(url.Values{"repeat": {"recurring"}})
+	assert.True(t, got[today])
+	assert.False(t, got[later])
+
+	got = ids(url.Values{"repeat": {"none"}})
+	assert.False(t, got[today])
+	assert.True(t, got[later])
+
+	for _, query := range []string{"due=soon", "repeat=always", "from=2024", "to=31.01.2024"} {
+		status, _, err := requestWithToken("api/tasks?"+query, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
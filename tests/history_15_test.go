@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getCompletions(t *testing.T, apipath string) []map[string]string {
+	body, err := requestJSON(apipath, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string][]map[string]string
+	assert.NoError(t, json.Unmarshal(body, &m))
+	return m["completions"]
+}
+
+func TestCompletionHistory(t *testing.T) {
+	today := time.Now().Format(`20060102`)
+	recurring := addTask(t, task{date: today, title: "Полить цветы", repeat: "d 3"})
+	for i := 0; i < 2; i++ {
+		_, err := postJSON("api/task/done?id="+recurring, nil, http.MethodPost)
+		assert.NoError(t, err)
+	}
+	history := getCompletions(t, "api/task/history?id="+recurring)
+	assert.Len(t, history, 2)
+	for _, v := range history {
+		assert.Equal(t, recurring, v["task_id"])
+		assert.Equal(t, "Полить цветы", v["title"])
+		assert.NotEmpty(t, v["completed_at"])
+	}
+	assert.Equal(t, today, history[1]["scheduled_date"])
+	assert.Equal(t, time.Now().AddDate(0, 0, 3).Format(`20060102`), history[0]["scheduled_date"])
+
+	once := addTask(t, task{date: today, title: "Вынести мусор"})
+	_, err := postJSON("api/task/done?id="+once, nil, http.MethodPost)
+	assert.NoError(t, err)
+	notFoundTask(t, once)
+	history = getCompletions(t, "api/v2/tasks/"+once+"/completions")
+	assert.Len(t, history, 1)
+	assert.Equal(t, "Вынести мусор", history[0]["title"])
+
+	all := getCompletions(t, "api/history?limit=3")
+	assert.Len(t, all, 3)
+	assert.Equal(t, once, all[0]["task_id"])
+}
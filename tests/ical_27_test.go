@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// icsComponents unfolds the feed and returns the properties of every component by UID.
+func icsComponents(t *testing.T, feed string) map[string]map[string]string {
+	for _, line := range strings.Split(feed, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+	components := map[string]map[string]string{}
+	var current map[string]string
+	for _, line := range strings.Split(unfolded, "\r\n") {
+		name, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "BEGIN:VEVENT" || line == "BEGIN:VTODO":
+			current = map[string]string{"COMPONENT": value}
+		case line == "END:VEVENT" || line == "END:VTODO":
+			components[current["UID"]] = current
+			current = nil
+		case current != nil:
+			current[name] = value
+		}
+	}
+	return components
+}
+
+func TestCalendarFeed(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	m, err := postJSON("api/tokens", map[string]any{"name": "calendar", "scopes": []string{"read"}}, http.MethodPost)
+	assert.NoError(t, err)
+	secret := fmt.Sprint(m["token"])
+	defer requestWithToken("api/tokens?id="+fmt.Sprint(m["id"]), http.MethodDelete, "", "")
+
+	var ids []string
+	defer func() {
+		for _, id := range ids {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+	for _, task := range []map[string]any{
+		{"date": "20990301", "title": "Полить цветы", "repeat": "d 3", "comment": "Фикус, кактус;\nорхидею — раз в неделю", "priority": 3},
+		{"date": "20990315", "title": "День рождения бабушки, купить подарок и заказать торт заранее", "repeat": "y", "tags": []string{"семья"}},
+	} {
+		ret, err := postJSON("api/task", task, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["id"], ret)
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+	uid := func(id string) string { return "task-" + id + "@final_project" }
+
+	resp, body, err := requestWithHeaders("api/calendar.ics?token="+secret, http.MethodGet, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/calendar")
+	feed := string(body)
+	assert.True(t, strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(feed, "END:VCALENDAR\r\n"))
+
+	events := icsComponents(t, feed)
+	watering := events[uid(ids[0])]
+	assert.Equal(t, "VEVENT", watering["COMPONENT"])
+	assert.Equal(t, "20990301", watering["DTSTART;VALUE=DATE"])
+	assert.Equal(t, "20990302", watering["DTEND;VALUE=DATE"])
+	assert.Equal(t, "FREQ=DAILY;INTERVAL=3", watering["RRULE"])
+	assert.Equal(t, `Фикус\, кактус\;\nорхидею — раз в неделю`, watering["DESCRIPTION"])
+	assert.Equal(t, "1", watering["PRIORITY"])
+	birthday := events[uid(ids[1])]
+	assert.Equal(t, "FREQ=YEARLY", birthday["RRULE"])
+	assert.Equal(t, `День рождения бабушки\, купить подарок и заказать торт заранее`, birthday["SUMMARY"])
+	assert.Equal(t, "семья", birthday["CATEGORIES"])
+
+	status, body, err := requestWithToken("api/calendar.ics?component=vtodo&token="+secret, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	todo := icsComponents(t, string(body))[uid(ids[0])]
+	assert.Equal(t, "VTODO", todo["COMPONENT"])
+	assert.Equal(t, "NEEDS-ACTION", todo["STATUS"])
+	assert.Equal(t, "20990301", todo["DUE;VALUE=DATE"])
+
+	status, _, err = requestWithToken("api/calendar.ics?token=fpt_invalid", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _, err = requestWithToken("api/calendar.ics?component=vjournal&token="+secret, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
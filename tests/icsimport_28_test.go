@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const importCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example//Planner//EN
+BEGIN:VEVENT
+UID:weekly@example.com
+DTSTART;VALUE=DATE:20990105
+SUMMARY:Командная встреча
+DESCRIPTION:Обсудить план\, бюджет и сроки\;\nпротокол отправить всем участн
+ икам после встречи
+CATEGORIES:работа,встречи
+RRULE:FREQ=WEEKLY;BYDAY=MO
+END:VEVENT
+BEGIN:VEVENT
+UID:gym@example.com
+DTSTART;TZID="Europe/Moscow":20990106T190000
+SUMMARY:Спортзал
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR
+END:VEVENT
+BEGIN:VTODO
+UID:report@example.com
+DUE;VALUE=DATE:20990110
+SUMMARY:Сдать отчёт
+STATUS:IN-PROCESS
+PRIORITY:1
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Напоминание
+TRIGGER:-PT15M
+END:VALARM
+END:VTODO
+BEGIN:VTODO
+UID:done@example.com
+DUE;VALUE=DATE:20990111
+SUMMARY:Уже сделано
+STATUS:COMPLETED
+END:VTODO
+BEGIN:VEVENT
+UID:hourly@example.com
+DTSTART:20990105T090000Z
+SUMMARY:Пить воду
+RRULE:FREQ=HOURLY
+END:VEVENT
+BEGIN:VEVENT
+UID:past@example.com
+DTSTART;VALUE=DATE:20000101
+SUMMARY:Встреча нового тысячелетия
+END:VEVENT
+BEGIN:VEVENT
+UID:birthday@example.com
+DTSTART;VALUE=DATE:19900315
+SUMMARY:День рождения Саши
+RRULE:FREQ=YEARLY
+END:VEVENT
+BEGIN:VEVENT
+UID:untitled@example.com
+DTSTART;VALUE=DATE:20990105
+END:VEVENT
+END:VCALENDAR
+`
+
+type importResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+	Items    []struct {
+		Index   int    `json:"index"`
+		UID     string `json:"uid"`
+		Status  string `json:"status"`
+		ID      string `json:"id"`
+		Repeat  string `json:"repeat"`
+		Warning string `json:"warning"`
+		Field   string `json:"field"`
+	} `json:"items"`
+}
+
+func TestICSImport(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	status, body, err := requestWithToken("api/import/ics", http.MethodPost, "",
+		strings.ReplaceAll(importCalendar, "\n", "\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	var result importResult
+	assert.NoError(t, json.Unmarshal(body, &result))
+	defer func() {
+		for _, item := range result.Items {
+			if item.ID != "" {
+				db.Exec(`DELETE FROM scheduler WHERE id = ?`, item.ID)
+			}
+		}
+	}()
+	assert.Equal(t, 4, result.Imported)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 2, result.Failed)
+	assert.Len(t, result.Items, 8)
+
+	byUID := map[string]int{}
+	for i, item := range result.Items {
+		assert.Equal(t, i, item.Index)
+		byUID[item.UID] = i
+	}
+
+	weekly := result.Items[byUID["weekly@example.com"]]
+	assert.Equal(t, "imported", weekly.Status)
+	assert.Equal(t, "d 7", weekly.Repeat)
+	assert.Empty(t, weekly.Warning)
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, weekly.ID))
+	assert.Equal(t, "20990105", row.Date)
+	assert.Equal(t, "Командная встреча", row.Title)
+	assert.Equal(t, "Обсудить план, бюджет и сроки;\nпротокол отправить всем участникам после встречи", row.Comment)
+	assert.Equal(t, []string{"встречи", "работа"}, getTaskTags(t, weekly.ID))
+
+	gym := result.Items[byUID["gym@example.com"]]
+	assert.Equal(t, "imported", gym.Status)
+	assert.Equal(t, "d 2", gym.Repeat)
+	assert.NotEmpty(t, gym.Warning)
+
+	report := result.Items[byUID["report@example.com"]]
+	assert.Equal(t, "imported", report.Status)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, report.ID))
+	assert.Equal(t, "20990110", row.Date)
+	assert.Equal(t, "in_progress", row.Status)
+	assert.Equal(t, int64(3), row.Priority)
+
+	birthday := result.Items[byUID["birthday@example.com"]]
+	assert.Equal(t, "imported", birthday.Status)
+	assert.Equal(t, "y", birthday.Repeat)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, birthday.ID))
+	assert.Equal(t, "0315", row.Date[4:])
+	assert.GreaterOrEqual(t, row.Date, time.Now().Format(`20060102`))
+
+	assert.Equal(t, "skipped", result.Items[byUID["done@example.com"]].Status)
+	assert.Equal(t, "skipped", result.Items[byUID["past@example.com"]].Status)
+	hourly := result.Items[byUID["hourly@example.com"]]
+	assert.Equal(t, "failed", hourly.Status)
+	assert.Equal(t, "repeat", hourly.Field)
+	assert.Empty(t, hourly.ID)
+	assert.Equal(t, "title", result.Items[byUID["untitled@example.com"]].Field)
+
+	status, _, err = requestWithToken("api/import/ics", http.MethodPost, "", `{"title":"не календарь"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
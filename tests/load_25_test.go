@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type dayLoad struct {
+	Date       string `json:"date"`
+	Estimate   int    `json:"estimate"`
+	Tasks      int    `json:"tasks"`
+	Overloaded bool   `json:"overloaded"`
+}
+
+func getLoad(t *testing.T, query string) map[string]dayLoad {
+	status, body, err := requestWithToken("api/agenda/load?"+query, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	var load struct {
+		Days []dayLoad `json:"days"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &load))
+	days := map[string]dayLoad{}
+	for _, day := range load.Days {
+		days[day.Date] = day
+	}
+	return days
+}
+
+func TestWorkload(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	const week = "from=20990105&to=20990111"
+	before := getLoad(t, week)
+	assert.Len(t, before, 7)
+
+	var ids []string
+	defer func() {
+		for _, id := range ids {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+	for _, task := range []map[string]any{
+		{"date": "20990106", "title": "Годовой отчёт", "estimate": 300},
+		{"date": "20990101", "title": "Тренировка", "repeat": "d 2", "estimate": 120},
+		{"date": "20980107", "title": "Продление страховки", "repeat": "y", "estimate": 60},
+		{"date": "20990108", "title": "Позвонить маме"},
+	} {
+		ret, err := postJSON("api/task", task, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["id"], ret)
+		ids = append(ids, fmt.Sprint(ret["id"]))
+	}
+
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, ids[0]))
+	assert.Equal(t, int64(300), row.Estimate)
+
+	after := getLoad(t, week+"&capacity=250")
+	for date, delta := range map[string]struct{ estimate, tasks int }{
+		"20990105": {120, 1},
+		"20990106": {300, 1},
+		"20990107": {180, 2},
+		"20990108": {0, 1},
+		"20990109": {120, 1},
+		"20990110": {0, 0},
+		"20990111": {120, 1},
+	} {
+		assert.Equal(t, before[date].Estimate+delta.estimate, after[date].Estimate, date)
+		assert.Equal(t, before[date].Tasks+delta.tasks, after[date].Tasks, date)
+	}
+	assert.True(t, after["20990106"].Overloaded)
+
+	// Completed tasks no longer load their day.
+	status, _, err := requestWithToken("api/task/status?id="+ids[0], http.MethodPost, "", `{"status":"done"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, before["20990106"], getLoad(t, week)["20990106"])
+
+	status, _, err = requestWithToken("api/task?id="+ids[1], http.MethodPatch, "", `{"estimate":null}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, before["20990105"].Estimate, getLoad(t, week)["20990105"].Estimate)
+
+	for _, body := range []string{
+		`{"date":"20990106","title":"Слишком долго","estimate":1441}`,
+		`{"date":"20990106","title":"Отрицательная оценка","estimate":-5}`,
+	} {
+		status, _, err = requestWithToken("api/task", http.MethodPost, "", body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+	for _, query := range []string{"from=20990111&to=20990105", "from=20990101&to=21000105", "from=завтра", "capacity=-1"} {
+		status, _, err = requestWithToken("api/agenda/load?"+query, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
+
+func TestPutKeepsEstimate(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	ret, err := postJSON("api/task", map[string]any{"date": "20990106", "title": "Сдать отчёт",
+		"priority": 3, "estimate": 60, "tags": []string{"a"}}, http.MethodPost)
+	assert.NoError(t, err)
+	id := fmt.Sprint(ret["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+
+	// An edit that sends only the fields of the web UI form keeps the rest.
+	_, err = postJSON("api/task", map[string]any{"id": id, "date": "20990107", "title": "Сдать отчёт"}, http.MethodPut)
+	assert.NoError(t, err)
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, "20990107", row.Date)
+	assert.Equal(t, int64(3), row.Priority)
+	assert.Equal(t, int64(60), row.Estimate)
+	assert.Equal(t, []string{"a"}, getTaskTags(t, id))
+
+	_, err = postJSON("api/task", map[string]any{"id": id, "date": "20990107", "title": "Сдать отчёт", "estimate": 0}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Zero(t, row.Estimate)
+	assert.Equal(t, int64(3), row.Priority)
+}
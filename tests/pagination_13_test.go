@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tasksPage struct {
+	Tasks      []taskFields `json:"tasks"`
+	NextCursor string       `json:"next_cursor"`
+}
+
+func getAllPages(t *testing.T, params url.Values) []taskFields {
+	var all []taskFields
+	limit, _ := strconv.Atoi(params.Get("limit"))
+	for {
+		body, err := requestJSON("api/tasks?"+params.Encode(), nil, http.MethodGet)
+		assert.NoError(t, err)
+		var page tasksPage
+		assert.NoError(t, json.Unmarshal(body, &page))
+		assert.LessOrEqual(t, len(page.Tasks), limit)
+		all = append(all, page.Tasks...)
+		if page.NextCursor == "" {
+			return all
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+}
+
+func TestTasksPagination(t *testing.T) {
+	date := time.Now().AddDate(0, 0, 5).Format(`20060102`)
+	titles := []string{"Страница Д", "Страница Б", "Страница Г", "Страница А", "Страница В"}
+	ids := map[string]bool{}
+	for _, title := range titles {
+		ids[addTask(t, task{date: date, title: title})] = true
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		tasks := getAllPages(t, url.Values{"sort": {"title"}, "order": {order}, "limit": {"2"}})
+		var got []string
+		seen := map[string]bool{}
+		for _, v := range tasks {
+			assert.False(t, seen[v["id"]], "задача %s возвращена дважды", v["id"])
+			seen[v["id"]] = true
+			if ids[v["id"]] {
+				got = append(got, v["title"])
+			}
+		}
+		want := append([]string{}, titles...)
+		sort.Strings(want)
+		if order == "desc" {
+			sort.Sort(sort.Reverse(sort.StringSlice(want)))
+		}
+		assert.Equal(t, want, got)
+	}
+
+	tasks := getAllPages(t, url.Values{"date": {date}, "sort": {"created"}, "limit": {"2"}})
+	assert.Len(t, tasks, len(titles))
+	assert.True(t, sort.SliceIsSorted(tasks, func(i, j int) bool {
+		return len(tasks[i]["id"]) < len(tasks[j]["id"]) ||
+			len(tasks[i]["id"]) == len(tasks[j]["id"]) && strings.Compare(tasks[i]["id"], tasks[j]["id"]) < 0
+	}))
+
+	queries := []string{"limit=0", "limit=abc", "sort=color", "cursor=abc", "order=up"}
+	// Forged cursors with the wrong number or types of keys.
+	for _, forged := range []string{
+		`{"s":"date","k":["20240101"],"i":1}`,
+		`{"s":"date","k":["20240101",{"a":1}],"i":1}`,
+		`{"s":"title","k":[5],"i":1}`,
+		`{"s":"priority","k":["high","20240101"],"i":1}`,
+		`{"s":"priority","k":[-1.5,"20240101"],"i":1}`,
+	} {
+		queries = append(queries, "cursor="+base64.RawURLEncoding.EncodeToString([]byte(forged))+"&sort="+
+			strings.Split(forged, `"`)[3])
+	}
+	for _, query := range queries {
+		status, body, err := requestWithToken("api/tasks?"+query, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+		if strings.Contains(query, "cursor") {
+			assert.Contains(t, string(body), `"field":"cursor"`, query)
+		}
+	}
+}
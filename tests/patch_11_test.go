@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchTask(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	id := addTask(t, task{
+		title:   "Синхронизация календаря",
+		comment: "Не потерять комментарий",
+		repeat:  "d 5",
+	})
+	date := time.Now().AddDate(0, 0, 3).Format(`20060102`)
+
+	status, body, err := requestWithToken("api/task?id="+id, http.MethodPatch, "", `{"date":"`+date+`"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var m taskFields
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, date, m["date"])
+
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, date, task.Date)
+	assert.Equal(t, "Синхронизация календаря", task.Title)
+	assert.Equal(t, "Не потерять комментарий", task.Comment)
+	assert.Equal(t, "d 5", task.Repeat)
+
+	resp, _, err := requestWithHeaders("api/v2/tasks/"+id, http.MethodPatch, `{"comment":null,"repeat":null}`,
+		map[string]string{"If-Match": "*"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "", task.Comment)
+	assert.Equal(t, "", task.Repeat)
+	assert.Equal(t, date, task.Date)
+
+	for _, patch := range []string{`{"title":""}`, `{"date":"31.01.2024"}`, `{"repeat":"ooops"}`, `{"date":null}`} {
+		status, _, err = requestWithToken("api/task?id="+id, http.MethodPatch, "", patch)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, patch)
+	}
+
+	status, _, err = requestWithToken("api/task?id=987654321", http.MethodPatch, "", `{"title":"Нет"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type prioritizedTask struct {
+	ID       string `json:"id"`
+	Priority int    `json:"priority"`
+}
+
+func getPrioritizedTasks(t *testing.T, params url.Values) []prioritizedTask {
+	params.Set("limit", "500")
+	status, body, err := requestWithToken("api/tasks?"+params.Encode(), http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var resp struct {
+		Tasks []prioritizedTask `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &resp))
+	return resp.Tasks
+}
+
+func TestPriorities(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	date := time.Now().AddDate(0, 0, 40).Format(`20060102`)
+	add := func(title string, priority int) string {
+		ret, err := postJSON("api/task", map[string]any{"title": title, "date": date, "priority": priority}, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotNil(t, ret["id"])
+		return fmt.Sprint(ret["id"])
+	}
+	low := add("Разобрать почту", 0)
+	urgent := add("Продлить домен", 3)
+	normal := add("Позвонить в банк", 1)
+	// Numeric priorities would break the legacy tests that decode tasks as strings.
+	defer func() {
+		for _, id := range []string{low, urgent, normal} {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+		}
+	}()
+
+	ids := func(tasks []prioritizedTask) []string {
+		var ret []string
+		for _, task := range tasks {
+			ret = append(ret, task.ID)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{urgent, normal, low}, ids(getPrioritizedTasks(t, url.Values{"date": {date}})))
+
+	// Paging keeps the order across pages.
+	var paged []string
+	params := url.Values{"date": {date}}
+	for {
+		params.Set("limit", "1")
+		status, body, err := requestWithToken("api/tasks?"+params.Encode(), http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		var resp struct {
+			Tasks      []prioritizedTask `json:"tasks"`
+			NextCursor string            `json:"next_cursor"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &resp))
+		paged = append(paged, ids(resp.Tasks)...)
+		if resp.NextCursor == "" || len(paged) > 3 {
+			break
+		}
+		params.Set("cursor", resp.NextCursor)
+	}
+	assert.Equal(t, []string{urgent, normal, low}, paged)
+
+	tasks := getPrioritizedTasks(t, url.Values{"sort": {"priority"}, "high_priority": {"true"}})
+	assert.NotEmpty(t, tasks)
+	for i, task := range tasks {
+		assert.GreaterOrEqual(t, task.Priority, 2)
+		if i > 0 {
+			assert.LessOrEqual(t, task.Priority, tasks[i-1].Priority)
+		}
+	}
+	assert.Contains(t, ids(tasks), urgent)
+	assert.NotContains(t, ids(tasks), normal)
+
+	status, _, err := requestWithToken("api/task?id="+normal, http.MethodPatch, "", `{"priority":2}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, normal))
+	assert.Equal(t, int64(2), row.Priority)
+	assert.Contains(t, ids(getPrioritizedTasks(t, url.Values{"min_priority": {"2"}})), normal)
+
+	for _, body := range []string{`{"title":"Слишком важно","priority":4}`, `{"title":"Неважно","priority":-1}`} {
+		status, _, err = requestWithToken("api/task", http.MethodPost, "", body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+	status, _, err = requestWithToken("api/task?id="+normal, http.MethodPatch, "", `{"priority":"high"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	for _, query := range []string{"min_priority=9", "high_priority=maybe"} {
+		status, _, err = requestWithToken("api/tasks?"+query, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
+
+func TestPutKeepsPriority(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	date := time.Now().AddDate(0, 0, 40).Format(`20060102`)
+	ret, err := postJSON("api/task", map[string]any{"title": "Заплатить налог", "date": date, "priority": 3}, http.MethodPost)
+	assert.NoError(t, err)
+	id := fmt.Sprint(ret["id"])
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+
+	// The web UI edit form does not send the priority.
+	for _, path := range []string{"api/task", "api/v2/tasks/" + id} {
+		status, body, err := requestWithToken(path, http.MethodPut, "",
+			fmt.Sprintf(`{"id":%q,"title":"Заплатить налог","date":%q}`, id, date))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status, string(body))
+		var row Task
+		assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+		assert.Equal(t, int64(3), row.Priority, path)
+	}
+
+	status, body, err := requestWithToken("api/task", http.MethodPut, "",
+		fmt.Sprintf(`{"id":%q,"title":"Заплатить налог","date":%q,"priority":0}`, id, date))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, string(body))
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Zero(t, row.Priority)
+}
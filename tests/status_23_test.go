@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setStatus(t *testing.T, id, status string) (int, map[string]any) {
+	code, body, err := requestWithToken("api/task/status?id="+id, http.MethodPost, "", `{"status":"`+status+`"}`)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	return code, m
+}
+
+func TestStatusWorkflow(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	today := time.Now().Format(`20060102`)
+
+	id := addTask(t, task{date: today, title: "Написать статью"})
+	recurring := addTask(t, task{date: today, title: "Еженедельный обзор", repeat: "d 7"})
+	defer func() {
+		for _, task := range []string{id, recurring} {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, task)
+		}
+	}()
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, "todo", row.Status)
+
+	status, m := setStatus(t, id, "in_progress")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "in_progress", m["status"])
+
+	status, _, err := requestWithToken("api/task?id="+id, http.MethodPatch, "", `{"status":"waiting"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/task?id="+id, http.MethodPatch, "", `{"status":"done"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = setStatus(t, id, "blocked")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// A one-off task moved to done stays on the board and gets a completion.
+	status, m = setStatus(t, id, "done")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "done", m["status"])
+	assert.Len(t, getCompletions(t, "api/task/history?id="+id), 1)
+	status, _ = setStatus(t, id, "waiting")
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = setStatus(t, id, "done")
+	assert.Equal(t, http.StatusConflict, status)
+
+	// A recurring task moves on to its next date and starts over.
+	status, m = setStatus(t, recurring, "done")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "todo", m["status"])
+	assert.NotEqual(t, today, m["date"])
+
+	// MarkTaskDone keeps its behaviour regardless of the status.
+	status, _ = setStatus(t, recurring, "in_progress")
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/task/done?id="+recurring, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, recurring))
+	assert.Equal(t, "todo", row.Status)
+
+	tasks := getAllPages(t, map[string][]string{"status": {"done"}, "limit": {"500"}})
+	found := map[string]bool{}
+	for _, task := range tasks {
+		found[task["id"]] = true
+		assert.Equal(t, "done", task["status"])
+	}
+	assert.True(t, found[id])
+	assert.False(t, found[recurring])
+
+	status, body, err := requestWithToken("api/board?limit=500", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var board struct {
+		Columns []struct {
+			Status      string       `json:"status"`
+			Transitions []string     `json:"transitions"`
+			Tasks       []taskFields `json:"tasks"`
+		} `json:"columns"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &board))
+	var columns []string
+	column := map[string]string{}
+	for _, c := range board.Columns {
+		columns = append(columns, c.Status)
+		for _, task := range c.Tasks {
+			column[task["id"]] = c.Status
+		}
+	}
+	assert.Equal(t, []string{"todo", "in_progress", "waiting", "done"}, columns)
+	assert.Equal(t, []string{"todo"}, board.Columns[3].Transitions)
+	assert.Equal(t, "done", column[id])
+	assert.Equal(t, "todo", column[recurring])
+
+	status, _ = setStatus(t, id, "todo")
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/board?status=todo", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
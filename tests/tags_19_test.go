@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taggedTask struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+func getTaggedTasks(t *testing.T, params url.Values) map[string][]string {
+	params.Set("limit", "500")
+	status, body, err := requestWithToken("api/tasks?"+params.Encode(), http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var resp struct {
+		Tasks []taggedTask `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &resp))
+	found := map[string][]string{}
+	for _, task := range resp.Tasks {
+		found[task.ID] = task.Tags
+	}
+	return found
+}
+
+func getTaskTags(t *testing.T, id string) []string {
+	status, body, err := requestWithToken("api/task?id="+id, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var task taggedTask
+	assert.NoError(t, json.Unmarshal(body, &task))
+	return task.Tags
+}
+
+func TestTags(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	add := func(title string, tags ...string) string {
+		ret, err := postJSON("api/task", map[string]any{"title": title, "tags": tags}, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotNil(t, ret["id"])
+		return fmt.Sprint(ret["id"])
+	}
+	home := add("Полить цветы", "Home", " errands ", "home")
+	work := add("Отчёт", "work")
+	both := add("Купить картридж", "work", "errands")
+	// Leave no tags behind for the tests counting them.
+	defer func() {
+		for _, id := range []string{home, work, both} {
+			db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+			db.Exec(`DELETE FROM task_tags WHERE task_id = ?`, id)
+		}
+	}()
+
+	assert.Equal(t, []string{"errands", "home"}, getTaskTags(t, home))
+
+	got := getTaggedTasks(t, url.Values{"tags": {"work,errands"}})
+	assert.Contains(t, got, home)
+	assert.Contains(t, got, work)
+	assert.Contains(t, got, both)
+	assert.Equal(t, []string{"errands", "work"}, got[both])
+
+	got = getTaggedTasks(t, url.Values{"tags": {"work", "errands"}, "tag_mode": {"all"}})
+	assert.NotContains(t, got, home)
+	assert.NotContains(t, got, work)
+	assert.Contains(t, got, both)
+
+	got = getTaggedTasks(t, url.Values{"tags": {"HOME"}})
+	assert.Contains(t, got, home)
+	assert.NotContains(t, got, both)
+
+	// PUT without tags keeps them, an empty array clears them.
+	status, _, err := requestWithToken("api/task", http.MethodPut, "",
+		`{"id":"`+work+`","title":"Отчёт за месяц","date":"","comment":"","repeat":""}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"work"}, getTaskTags(t, work))
+
+	status, _, err = requestWithToken("api/task", http.MethodPut, "",
+		`{"id":"`+work+`","title":"Отчёт за месяц","date":"","comment":"","repeat":"","tags":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	// A task without tags still lists them, as an empty array.
+	assert.Equal(t, []string{}, getTaskTags(t, work))
+	assert.Equal(t, []string{}, getTaggedTasks(t, url.Values{})[work])
+
+	token := undoToken(t, "api/task?id="+work, http.MethodPatch, `{"tags":["work","urgent"]}`)
+	assert.Equal(t, []string{"urgent", "work"}, getTaskTags(t, work))
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, getTaskTags(t, work))
+	undoToken(t, "api/task?id="+work, http.MethodPatch, `{"tags":["work","urgent"]}`)
+
+	status, body, err := requestWithToken("api/tags", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var tags struct {
+		Tags []struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		} `json:"tags"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &tags))
+	counts := map[string]int{}
+	for _, tag := range tags.Tags {
+		counts[tag.Name] = tag.Count
+	}
+	assert.GreaterOrEqual(t, counts["work"], 2)
+	assert.GreaterOrEqual(t, counts["urgent"], 1)
+
+	status, _, err = requestWithToken("api/task", http.MethodPost, "", `{"title":"Пустой тег","tags":[" "]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _, err = requestWithToken("api/task?id="+work, http.MethodPatch, "", `{"tags":"work"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _, err = requestWithToken("api/tasks?tags=work&tag_mode=some", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -24,7 +24,27 @@ func addTask(t *testing.T, task task) string {
 	return id
 }
 
-func getTasks(t *testing.T, search string) []map[string]string {
+// taskFields holds the fields of a task as strings; fields that are not JSON strings,
+// like the list of tags, keep their JSON text.
+type taskFields map[string]string
+
+func (f *taskFields) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = make(taskFields, len(raw))
+	for name, value := range raw {
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			s = string(value)
+		}
+		(*f)[name] = s
+	}
+	return nil
+}
+
+func getTasks(t *testing.T, search string) []taskFields {
 	url := "api/tasks"
 	if Search {
 		url += "?search=" + search
@@ -32,7 +52,7 @@ func getTasks(t *testing.T, search string) []map[string]string {
 	body, err := requestJSON(url, nil, http.MethodGet)
 	assert.NoError(t, err)
 
-	var m map[string][]map[string]string
+	var m map[string][]taskFields
 	err = json.Unmarshal(body, &m)
 	assert.NoError(t, err)
 	return m["tasks"]
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeEntry struct {
+	ID        string `json:"id"`
+	TaskID    string `json:"task_id"`
+	StartedAt string `json:"started_at"`
+	EndedAt   string `json:"ended_at"`
+	Seconds   int64  `json:"seconds"`
+}
+
+func TestTimeTracking(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	today := time.Now().Format(`20060102`)
+
+	id := addTask(t, task{date: today, title: "Уборка у клиента", repeat: "d 7"})
+	defer db.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+
+	started := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	status, body, err := requestWithToken("api/task/time?id="+id, http.MethodPost, "",
+		fmt.Sprintf(`{"started_at":"%s","seconds":1800,"note":"Выезд"}`, started))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status, string(body))
+	var manual timeEntry
+	assert.NoError(t, json.Unmarshal(body, &manual))
+	assert.Equal(t, int64(1800), manual.Seconds)
+	assert.NotEmpty(t, manual.EndedAt)
+
+	status, body, err = requestWithToken("api/task/timer/start?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status, string(body))
+	status, _, err = requestWithToken("api/task/timer/start?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+	status, body, err = requestWithToken("api/task/timer/stop?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var timer timeEntry
+	assert.NoError(t, json.Unmarshal(body, &timer))
+	assert.NotEmpty(t, timer.EndedAt)
+	status, _, err = requestWithToken("api/task/timer/stop?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, body, err = requestWithToken("api/task/time?id="+id, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var entries struct {
+		Entries      []timeEntry `json:"entries"`
+		TotalSeconds int64       `json:"total_seconds"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &entries))
+	assert.Len(t, entries.Entries, 2)
+	assert.GreaterOrEqual(t, entries.TotalSeconds, int64(1800))
+
+	for _, group := range []string{"day", "week"} {
+		status, body, err = requestWithToken("api/time?group="+group+"&task_id="+id, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		var report struct {
+			Periods []struct {
+				Start   string `json:"start"`
+				Seconds int64  `json:"seconds"`
+			} `json:"periods"`
+			Tasks []struct {
+				TaskID  string `json:"task_id"`
+				Seconds int64  `json:"seconds"`
+			} `json:"tasks"`
+			TotalSeconds int64 `json:"total_seconds"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &report))
+		assert.Equal(t, entries.TotalSeconds, report.TotalSeconds, group)
+		assert.NotEmpty(t, report.Periods, group)
+		assert.Len(t, report.Tasks, 1)
+		assert.Equal(t, id, report.Tasks[0].TaskID)
+	}
+
+	// The completion carries the time tracked since the previous completion.
+	requestWithToken("api/task/timer/start?id="+id, http.MethodPost, "", "")
+	completions := func() []map[string]any {
+		status, body, err := requestWithToken("api/task/history?id="+id, http.MethodGet, "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		var m map[string][]map[string]any
+		assert.NoError(t, json.Unmarshal(body, &m))
+		return m["completions"]
+	}
+	status, _, err = requestWithToken("api/task/done?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	history := completions()
+	assert.Len(t, history, 1)
+	assert.GreaterOrEqual(t, history[0]["tracked_seconds"], float64(1800))
+	status, _, err = requestWithToken("api/task/timer/stop?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, status, "completing stops the timer")
+
+	status, _, err = requestWithToken("api/task/done?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	history = completions()
+	assert.Len(t, history, 2)
+	assert.Nil(t, history[0]["tracked_seconds"])
+
+	// Time entered after a completion counts towards the next one, even if it started earlier.
+	started = time.Now().Add(-3 * time.Hour).UTC().Format(time.RFC3339)
+	status, body, err = requestWithToken("api/task/time?id="+id, http.MethodPost, "",
+		fmt.Sprintf(`{"started_at":"%s","seconds":600}`, started))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status, string(body))
+	status, _, err = requestWithToken("api/task/done?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	history = completions()
+	assert.Len(t, history, 3)
+	assert.Equal(t, float64(600), history[0]["tracked_seconds"])
+
+	status, _, err = requestWithToken("api/task/time?id="+id+"&entry="+manual.ID, http.MethodDelete, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/task/time?id="+id+"&entry="+manual.ID, http.MethodDelete, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	for _, body := range []string{`{"seconds":0}`, `{"seconds":60,"started_at":"вчера"}`} {
+		status, _, err = requestWithToken("api/task/time?id="+id, http.MethodPost, "", body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+	status, _, err = requestWithToken("api/task/timer/start?id=987654321", http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _, err = requestWithToken("api/time?group=month", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requestWithToken sends If-Match: * so that changes overwrite any version.
+func requestWithToken(apipath, method, token, body string) (int, []byte, error) {
+	headers := map[string]string{"If-Match": "*"}
+	if len(token) > 0 {
+		headers["Authorization"] = "Bearer " + token
+	}
+	resp, data, err := requestWithHeaders(apipath, method, body, headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, data, nil
+}
+
+func requestWithHeaders(apipath, method, body string, headers map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, getURL(apipath), strings.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp, data, err
+}
+
+func TestAPITokens(t *testing.T) {
+	m, err := postJSON("api/tokens", map[string]any{
+		"name":   "backup script",
+		"scopes": []string{"read"},
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	secret := fmt.Sprint(m["token"])
+	id := fmt.Sprint(m["id"])
+	assert.NotEmpty(t, secret)
+
+	status, _, err := requestWithToken("api/tasks", http.MethodGet, secret, "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _, err = requestWithToken("api/task", http.MethodPost, secret, `{"title":"Нельзя"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, body, err := requestWithToken("api/tokens", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var list map[string][]map[string]any
+	assert.NoError(t, json.Unmarshal(body, &list))
+	found := false
+	for _, v := range list["tokens"] {
+		if fmt.Sprint(v["id"]) == id {
+			found = true
+			assert.NotEmpty(t, v["last_used_at"])
+			assert.Nil(t, v["token"])
+		}
+	}
+	assert.True(t, found)
+
+	_, err = postJSON("api/tokens?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+
+	status, _, err = requestWithToken("api/tasks", http.MethodGet, secret, "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// Without a password the token endpoints would let anyone who reaches the port mint
+// a token, so they only answer requests from the machine itself.
+func TestTokensOnlyFromLocalhost(t *testing.T) {
+	if len(Token) > 0 {
+		t.Skip("the server has a password")
+	}
+	var external net.IP
+	addrs, err := net.InterfaceAddrs()
+	assert.NoError(t, err)
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			external = ipnet.IP
+			break
+		}
+	}
+	if external == nil {
+		t.Skip("no address other than loopback")
+	}
+	url := strings.Replace(getURL("api/tokens"), "localhost", external.String(), 1)
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Skip("the server cannot be reached at " + external.String())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	status, _, err := requestWithToken("api/tokens", http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func inTrash(t *testing.T, id string) bool {
+	body, err := requestJSON("api/trash", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string][]taskFields
+	assert.NoError(t, json.Unmarshal(body, &m))
+	for _, v := range m["tasks"] {
+		if v["id"] == id {
+			assert.NotEmpty(t, v["deleted_at"])
+			return true
+		}
+	}
+	return false
+}
+
+func TestTrash(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	id := addTask(t, task{title: "Случайно удалённая", comment: "важное"})
+	ret, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	notFoundTask(t, id)
+	for _, v := range getTasks(t, "") {
+		assert.NotEqual(t, id, v["id"])
+	}
+	require.True(t, inTrash(t, id))
+
+	var task Task
+	assert.NoError(t, db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.NotNil(t, task.DeletedAt)
+
+	status, body, err := requestWithToken("api/trash/restore?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var m taskFields
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, "важное", m["comment"])
+	assert.False(t, inTrash(t, id))
+
+	status, _, err = requestWithToken("api/trash/restore?id="+id, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	_, err = postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	status, _, err = requestWithToken("api/v2/trash/"+id, http.MethodDelete, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, inTrash(t, id))
+
+	var n int
+	assert.NoError(t, db.Get(&n, `SELECT count(*) FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, 0, n)
+}
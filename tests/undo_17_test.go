@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func undoToken(t *testing.T, apipath, method, body string) string {
+	resp, _, err := requestWithHeaders(apipath, method, body, map[string]string{"If-Match": "*"})
+	assert.NoError(t, err)
+	assert.Less(t, resp.StatusCode, 300)
+	token := resp.Header.Get("X-Undo-Token")
+	assert.NotEmpty(t, token)
+	return token
+}
+
+func undo(t *testing.T, token string) (int, map[string]any) {
+	status, body, err := requestWithToken("api/undo?token="+token, http.MethodPost, "", "")
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	return status, m
+}
+
+func TestUndo(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	today := time.Now().Format(`20060102`)
+
+	id := addTask(t, task{date: today, title: "Разовая"})
+	token := undoToken(t, "api/task/done?id="+id, http.MethodPost, "")
+	notFoundTask(t, id)
+	status, m := undo(t, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "done", m["operation"])
+	var row Task
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, "Разовая", row.Title)
+	assert.Empty(t, getCompletions(t, "api/task/history?id="+id))
+
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusConflict, status)
+
+	id = addTask(t, task{date: today, title: "Повторяющаяся", repeat: "d 4"})
+	token = undoToken(t, "api/task/done?id="+id, http.MethodPost, "")
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, today, row.Date)
+
+	token = undoToken(t, "api/task", http.MethodPut, `{"id":"`+id+`","date":"`+today+`","title":"Изменённая"}`)
+	// Without a token nothing is undone: the latest operation may be someone else's.
+	status, body, err := requestWithToken("api/undo", http.MethodPost, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status, string(body))
+	resp, body, err := requestWithHeaders("api/undo", http.MethodPost, "", map[string]string{"X-Undo-Token": token})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, "Повторяющаяся", row.Title)
+
+	token = undoToken(t, "api/task?id="+id, http.MethodDelete, "")
+	notFoundTask(t, id)
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, err = requestWithToken("api/task?id="+id, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	insert := undoToken(t, "api/task", http.MethodPost, `{"title":"Лишняя"}`)
+	status, m = undo(t, insert)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, m["task"])
+	var n int
+	assert.NoError(t, db.Get(&n, `SELECT count(*) FROM scheduler WHERE id=?`, m["task_id"]))
+	assert.Equal(t, 0, n)
+
+	update := undoToken(t, "api/task?id="+id, http.MethodPatch, `{"comment":"первая"}`)
+	second := undoToken(t, "api/task?id="+id, http.MethodPatch, `{"comment":"вторая"}`)
+	status, _ = undo(t, update)
+	assert.Equal(t, http.StatusConflict, status)
+	// Undoing the later change first makes the earlier one undoable.
+	status, _ = undo(t, second)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = undo(t, update)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, db.Get(&row, `SELECT * FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, "", row.Comment)
+
+	// A task purged from the trash is not brought back.
+	token = undoToken(t, "api/task?id="+id, http.MethodDelete, "")
+	status, _, err = requestWithToken("api/trash?id="+id, http.MethodDelete, "", "")
+	assert.NoError(t, err)
+	assert.Less(t, status, 300)
+	status, _ = undo(t, token)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.NoError(t, db.Get(&n, `SELECT count(*) FROM scheduler WHERE id=?`, id))
+	assert.Equal(t, 0, n)
+
+	status, _ = undo(t, "unknown")
+	assert.Equal(t, http.StatusNotFound, status)
+}
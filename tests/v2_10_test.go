@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTasksV2(t *testing.T) {
+	today := time.Now().Format(`20060102`)
+
+	req, err := http.NewRequest(http.MethodPost, getURL("api/v2/tasks"),
+		strings.NewReader(`{"title":"REST","comment":"v2","repeat":"d 2"}`))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var created taskFields
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	id := created["id"]
+	assert.NotEmpty(t, id)
+	assert.Equal(t, today, created["date"])
+	assert.Equal(t, "/api/v2/tasks/"+id, resp.Header.Get("Location"))
+	location := strings.TrimPrefix(resp.Header.Get("Location"), "/")
+
+	status, body, err := requestWithToken(location, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	var m taskFields
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, "REST", m["title"])
+
+	anyVersion := map[string]string{"If-Match": "*"}
+	resp, body, err = requestWithHeaders(location, http.MethodPut,
+		`{"title":"REST PUT","date":"`+today+`","repeat":"d 2"}`, anyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, id, m["id"])
+	assert.Equal(t, "REST PUT", m["title"])
+	date, err := time.Parse(`20060102`, m["date"])
+	assert.NoError(t, err)
+
+	resp, body, err = requestWithHeaders(location+"/done", http.MethodPost, "", anyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, date.AddDate(0, 0, 2).Format(`20060102`), m["date"])
+
+	resp, _, err = requestWithHeaders(location, http.MethodDelete, "", anyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	status, _, err = requestWithToken(location, http.MethodGet, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+}
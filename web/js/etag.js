@@ -0,0 +1,57 @@
+// The API refuses task changes without If-Match, so that one user cannot
+// silently overwrite another's edit. The ETags of the tasks the page has shown,
+// from the list and from the task form, are remembered and sent with the
+// changes; a task changed elsewhere since then is refused with 412.
+(function () {
+    const etags = {};
+    const list = /^\/?api\/tasks(\?|$)/;
+    const writes = /^\/?api\/task(\/done|\/status)?(\?|$)/;
+
+    function taskID(config) {
+        const query = config.url.split("?")[1] || "";
+        const id = new URLSearchParams(query).get("id");
+        if (id) {
+            return id;
+        }
+        const data = typeof config.data === "string" ? JSON.parse(config.data || "{}") : config.data;
+        return data && data.id ? String(data.id) : "";
+    }
+
+    axios.interceptors.request.use((config) => {
+        const method = (config.method || "get").toLowerCase();
+        if (method === "get" || !writes.test(config.url) || (method === "post" && !config.url.includes("?"))) {
+            return config;
+        }
+        const etag = etags[taskID(config)];
+        if (etag) {
+            config.headers = config.headers || {};
+            config.headers["If-Match"] = etag;
+        }
+        return config;
+    });
+
+    axios.interceptors.response.use((resp) => {
+        if (list.test(resp.config.url) && resp.data && resp.data.tasks) {
+            for (const task of resp.data.tasks) {
+                etags[task.id] = task.etag;
+            }
+            return resp;
+        }
+        const etag = resp.headers && resp.headers.etag;
+        if (etag && writes.test(resp.config.url)) {
+            const id = taskID(resp.config);
+            if (id) {
+                etags[id] = etag;
+            }
+        }
+        return resp;
+    }, (err) => {
+        // The page shows the message of a refused change; other errors reach the
+        // callers as they are.
+        const resp = err.response;
+        if (resp && (resp.status === 412 || resp.status === 428) && resp.data && resp.data.error) {
+            return Promise.reject(resp.data.error);
+        }
+        return Promise.reject(err);
+    });
+})();